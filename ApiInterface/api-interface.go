@@ -2,11 +2,15 @@ package ApiInterface
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -53,14 +57,42 @@ func Decode(token string) (map[string]interface{}, error) {
 	return payload, nil
 }
 
-func fetch(domain, path string, headers map[string]string, data []byte) ([]byte, error) {
+// StatusError is returned when Ytrack answers with a status other than 200
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return "ytrack responded with " + e.Status
+}
+
+// RequestIdHeader carries the id of the request that triggered a call to Ytrack, so that both sides log the same id
+const RequestIdHeader = "X-Request-ID"
+
+type contextKey string
+
+const requestIdKey contextKey = "requestId"
+
+// WithRequestId returns a copy of ctx carrying the request id sent along the calls made with it
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey, id)
+}
+
+// RequestId returns the request id stored in ctx by WithRequestId, or an empty string
+func RequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey).(string)
+	return id
+}
+
+func fetch(ctx context.Context, domain, path string, headers map[string]string, data []byte) ([]byte, error) {
 	client := &http.Client{}
 	method := "GET"
 	if data != nil {
 		method = "POST"
 	}
 
-	req, err := http.NewRequest(method, fmt.Sprintf("https://%s%s", domain, path), bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("https://%s%s", domain, path), bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
@@ -68,6 +100,11 @@ func fetch(domain, path string, headers map[string]string, data []byte) ([]byte,
 	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
+	if id := RequestId(ctx); id != "" {
+		req.Header.Set(RequestIdHeader, id)
+	}
+	// the traceparent header links the spans of Ytrack to ours
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -76,7 +113,7 @@ func fetch(domain, path string, headers map[string]string, data []byte) ([]byte,
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New(resp.Status)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -96,17 +133,21 @@ func isExpired(payload map[string]interface{}) bool {
 	return diff <= 0
 }
 
-func refreshToken(domain, token string) (string, map[string]interface{}, error) {
+func refreshToken(ctx context.Context, domain, token string) (newToken string, payload map[string]interface{}, err error) {
+	ctx, span := tracer.Start(ctx, "token refresh", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
 	headers := map[string]string{
 		"x-jwt-token": token,
 	}
-	res, err := fetch(domain, "/api/auth/refresh", headers, nil)
+	res, err := fetch(ctx, domain, "/api/auth/refresh", headers, nil)
 	if err != nil {
+		tokenRefreshes.WithLabelValues(result(err)).Inc()
 		return "", nil, err
 	}
 
-	newToken := string(res)
-	payload, err := Decode(newToken)
+	newToken = string(res)
+	payload, err = Decode(newToken)
+	tokenRefreshes.WithLabelValues(result(err)).Inc()
 	if err != nil {
 		return "", nil, err
 	}
@@ -141,19 +182,24 @@ func StoreToken(token string) {
 	}
 }
 
+// Client runs the queries against Ytrack. The copies returned by WithContext share the token of the
+// client they were made from.
 type Client struct {
 	domain            string
 	accessToken       string
-	mu                sync.Mutex
+	mu                *sync.Mutex
 	pendingTokenQuery *sync.Once
+	ctx               context.Context
 }
 
 func NewClient(domain string) (*Client, error) {
 	client := &Client{
 		domain: domain,
+		mu:     &sync.Mutex{},
+		ctx:    context.Background(),
 	}
 	InitialJWT := LoadToken()
-	refreshedToken, _, err := refreshToken(domain, InitialJWT)
+	refreshedToken, _, err := refreshToken(client.ctx, domain, InitialJWT)
 	//remove the first and last character of the string
 	if err != nil {
 		return nil, err
@@ -166,7 +212,20 @@ func NewClient(domain string) (*Client, error) {
 	return client, nil
 }
 
-func (c *Client) getToken() (string, error) {
+// WithContext returns a client whose calls are bound to ctx: they are cancelled with it and carry its
+// request id
+func (c *Client) WithContext(ctx context.Context) *Client {
+	bound := *c
+	bound.ctx = ctx
+	return &bound
+}
+
+// Context returns the context the calls of the client are bound to
+func (c *Client) Context() context.Context {
+	return c.ctx
+}
+
+func (c *Client) getToken(ctx context.Context) (string, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	val, ok := storage.Load(tokenKey)
@@ -180,7 +239,7 @@ func (c *Client) getToken() (string, error) {
 	}
 	if isExpired(payload) {
 		var err error
-		JWT, payload, err = refreshToken(c.domain, JWT)
+		JWT, payload, err = refreshToken(ctx, c.domain, JWT)
 		if err != nil {
 			return "", err
 		}
@@ -189,7 +248,57 @@ func (c *Client) getToken() (string, error) {
 	return JWT, nil
 }
 
+// ErrInvalidToken is returned by VerifyToken when Ytrack refuses the token
+var ErrInvalidToken = errors.New("invalid token")
+
+// VerifyToken sends a query authenticated with the token of a user, Hasura answers it only when the token
+// is signed by Ytrack and not expired
+func (c *Client) VerifyToken(token string) (err error) {
+	ctx, span := tracer.Start(c.ctx, "token verify", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
+	form, err := json.Marshal(map[string]interface{}{"query": "query verify_token { __typename }"})
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{
+		"Authorization": "Bearer " + token,
+		"Content-Type":  "application/json",
+	}
+	body, err := fetch(ctx, c.domain, "/api/graphql-engine/v1/graphql", headers, form)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+	if len(response.Errors) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidToken, response.Errors[0].Message)
+	}
+	return nil
+}
+
 func (c *Client) Run(query string, variables map[string]interface{}) (map[string]interface{}, error) {
+	operation := operationLabel(query)
+	// the variables are left out of the span, they hold user ids and logins
+	ctx, span := startOperationSpan(c.ctx, query)
+	start := time.Now()
+	data, err := c.run(ctx, query, variables)
+	graphqlDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	graphqlRequests.WithLabelValues(operation, result(err)).Inc()
+	endSpan(span, err)
+	return data, err
+}
+
+func (c *Client) run(ctx context.Context, query string, variables map[string]interface{}) (map[string]interface{}, error) {
 	form, err := json.Marshal(map[string]interface{}{
 		"query":     query,
 		"variables": variables,
@@ -198,7 +307,7 @@ func (c *Client) Run(query string, variables map[string]interface{}) (map[string
 		return nil, err
 	}
 
-	token, err := c.getToken()
+	token, err := c.getToken(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -209,7 +318,7 @@ func (c *Client) Run(query string, variables map[string]interface{}) (map[string
 		"Content-Length": fmt.Sprintf("%d", len(form)),
 	}
 
-	body, err := fetch(c.domain, "/api/graphql-engine/v1/graphql", headers, form)
+	body, err := fetch(ctx, c.domain, "/api/graphql-engine/v1/graphql", headers, form)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,65 @@
+package ApiInterface
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"regexp"
+	"sync"
+)
+
+// The operation label of the queries that are not allowed, or have no name
+const otherOperation = "other"
+
+var (
+	graphqlRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ytrack_graphql_requests_total",
+		Help: "GraphQL requests sent to Hasura by operation name and result (success or error).",
+	}, []string{"operation", "result"})
+	graphqlDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ytrack_graphql_request_duration_seconds",
+		Help:    "Latency of the GraphQL requests sent to Hasura by operation name.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+	tokenRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ytrack_token_refreshes_total",
+		Help: "Refreshes of the Ytrack token by result (success or error).",
+	}, []string{"result"})
+)
+
+var (
+	operationPattern  = regexp.MustCompile(`^\s*(?:query|mutation|subscription)\s+([A-Za-z_][A-Za-z0-9_]*)`)
+	allowedOperations sync.Map
+)
+
+// AllowOperations adds operation names to the ones used as metric labels, the queries named otherwise are
+// counted together so that the labels stay bounded
+func AllowOperations(names ...string) {
+	for _, name := range names {
+		allowedOperations.Store(name, true)
+	}
+}
+
+// OperationName returns the name of the first operation of the query, or an empty string
+func OperationName(query string) string {
+	match := operationPattern.FindStringSubmatch(query)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// operationLabel returns the metric label of the query
+func operationLabel(query string) string {
+	name := OperationName(query)
+	if _, ok := allowedOperations.Load(name); !ok {
+		return otherOperation
+	}
+	return name
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
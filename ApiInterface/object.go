@@ -0,0 +1,57 @@
+package ApiInterface
+
+import (
+	"encoding/json"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/url"
+)
+
+var ErrCampusNotFound = errors.New("campus not found, check the platform configuration file")
+
+type Campus struct {
+	Id       int                    `json:"id"`
+	Name     string                 `json:"name"`
+	Type     string                 `json:"type"`
+	Attrs    map[string]interface{} `json:"attrs"`
+	Children map[string]CampusChild `json:"children"`
+}
+
+type CampusChild struct {
+	Id    int    `json:"id"`
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+}
+
+// GetCampus fetches the campus object from /api/object, the children are keyed by their name
+func (c *Client) GetCampus(campusName string) (campus Campus, err error) {
+	ctx, span := tracer.Start(c.ctx, "campus fetch", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("ytrack.campus.name", campusName)))
+	defer func() { endSpan(span, err) }()
+	body, err := fetch(ctx, c.domain, "/api/object/"+url.PathEscape(campusName), nil, nil)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return Campus{}, ErrCampusNotFound
+	}
+	if err != nil {
+		return Campus{}, err
+	}
+
+	if err = json.Unmarshal(body, &campus); err != nil {
+		return Campus{}, err
+	}
+	// an unknown campus can also be answered with an empty object
+	if campus.Id == 0 {
+		return Campus{}, ErrCampusNotFound
+	}
+	if campus.Children == nil {
+		campus.Children = make(map[string]CampusChild)
+	}
+	for name, child := range campus.Children {
+		child.Name = name
+		campus.Children[name] = child
+	}
+	return campus, nil
+}
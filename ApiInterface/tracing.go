@@ -0,0 +1,39 @@
+package ApiInterface
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"regexp"
+)
+
+// The spans are recorded by the tracer provider set with otel.SetTracerProvider, they are dropped until then
+var tracer = otel.Tracer("Ytrack-Manager/ApiInterface")
+
+var operationTypePattern = regexp.MustCompile(`^\s*(query|mutation|subscription)\b`)
+
+// startOperationSpan starts the span of a GraphQL request, named after its operation
+func startOperationSpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := "graphql"
+	attrs := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindClient)}
+	if match := operationTypePattern.FindStringSubmatch(query); match != nil {
+		name = match[1]
+		attrs = append(attrs, trace.WithAttributes(semconv.GraphQLOperationTypeKey.String(match[1])))
+	}
+	if operation := OperationName(query); operation != "" {
+		name += " " + operation
+		attrs = append(attrs, trace.WithAttributes(semconv.GraphQLOperationName(operation)))
+	}
+	return tracer.Start(ctx, name, attrs...)
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
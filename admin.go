@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type AdminRegistrationRequest struct {
+	UserId int    `json:"userId" validate:"required,min=1"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+type AdminRegistrationResult struct {
+	UserId   int    `json:"userId"`
+	CourseId int    `json:"courseId"`
+	Action   string `json:"action"`
+	Reason   string `json:"reason"`
+	DryRun   bool   `json:"dryRun"`
+	// Registered is the registration of the user once the action is done, or would be done for a dry run
+	Registered bool `json:"registered"`
+	// Changed tells whether the action modified, or would modify, the registration
+	Changed bool `json:"changed"`
+}
+
+// pathCourseId reads the {id} wildcard of the route as a course id
+func pathCourseId(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid course id")
+	}
+	return id, nil
+}
+
+// isDryRun reports whether the dryRun query parameter is set to a true value
+func isDryRun(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	return dryRun
+}
+
+// adminRegistrationHandler registers or removes any user from a course on behalf of an admin.
+// With ?dryRun=true nothing is changed and the response tells what would happen.
+func adminRegistrationHandler(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			returnJsonError(w, r, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+			return
+		}
+		courseId, err := pathCourseId(r)
+		if err != nil {
+			returnJsonError(w, r, err, http.StatusBadRequest)
+			return
+		}
+		var body AdminRegistrationRequest
+		if !decodeJsonBody(w, r, &body) {
+			return
+		}
+
+		registered, err := IsUserRegisteredToCourse(body.UserId, courseId, apiClient(r))
+		if err != nil {
+			returnJsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		result := AdminRegistrationResult{
+			UserId:     body.UserId,
+			CourseId:   courseId,
+			Action:     action,
+			Reason:     body.Reason,
+			DryRun:     isDryRun(r),
+			Registered: action == AuditActionRegister,
+			Changed:    registered != (action == AuditActionRegister),
+		}
+		if result.DryRun || !result.Changed {
+			returnJson(w, r, result)
+			return
+		}
+
+		if action == AuditActionRegister {
+			err = RegisterUserToCourse(body.UserId, courseId, apiClient(r))
+		} else {
+			err = RemoveUserFromCourse(body.UserId, courseId, apiClient(r))
+		}
+		entry := newAuditEntry(r, contextUserId(r), body.UserId, courseId, action, err)
+		entry.Reason = body.Reason
+		if auditErr := auditLog.Record(entry); auditErr != nil {
+			slog.ErrorContext(r.Context(), "audit log write failed", "error", auditErr)
+		}
+		if err != nil {
+			returnJsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		returnJson(w, r, result)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	AuditActionRegister   = "register"
+	AuditActionUnregister = "unregister"
+
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	RequestId string    `json:"requestId"`
+	ActorId   int       `json:"actorId"`
+	UserId    int       `json:"userId"`
+	EventId   int       `json:"eventId"`
+	Action    string    `json:"action"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Ip        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+}
+
+// AuditLog is an append-only JSON lines file recording every registration change
+type AuditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{path: path}
+}
+
+// newAuditEntry fills an entry with the information available in the request
+func newAuditEntry(r *http.Request, actorId int, userId int, eventId int, action string, err error) AuditEntry {
+	entry := AuditEntry{
+		Time:      time.Now().UTC(),
+		RequestId: requestId(r),
+		ActorId:   actorId,
+		UserId:    userId,
+		EventId:   eventId,
+		Action:    action,
+		Result:    AuditResultSuccess,
+		Ip:        clientIp(r),
+		UserAgent: r.UserAgent(),
+	}
+	if err != nil {
+		entry.Result = AuditResultFailure
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+func (a *AuditLog) Record(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+type AuditFilter struct {
+	ActorId int
+	UserId  int
+	EventId int
+	Action  string
+	Result  string
+	From    time.Time
+	To      time.Time
+	Limit   int
+}
+
+func (f AuditFilter) match(entry AuditEntry) bool {
+	if f.ActorId != 0 && entry.ActorId != f.ActorId {
+		return false
+	}
+	if f.UserId != 0 && entry.UserId != f.UserId {
+		return false
+	}
+	if f.EventId != 0 && entry.EventId != f.EventId {
+		return false
+	}
+	if f.Action != "" && entry.Action != f.Action {
+		return false
+	}
+	if f.Result != "" && entry.Result != f.Result {
+		return false
+	}
+	if !f.From.IsZero() && entry.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && entry.Time.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// parseAuditFilter reads the filters from the query string, dates use the RFC 3339 format
+func parseAuditFilter(values url.Values) (AuditFilter, error) {
+	var filter AuditFilter
+	var err error
+	ints := map[string]*int{
+		"actorId": &filter.ActorId,
+		"userId":  &filter.UserId,
+		"eventId": &filter.EventId,
+		"limit":   &filter.Limit,
+	}
+	for key, dest := range ints {
+		if v := values.Get(key); v != "" {
+			*dest, err = strconv.Atoi(v)
+			if err != nil {
+				return AuditFilter{}, errors.New("invalid " + key + " parameter")
+			}
+		}
+	}
+	dates := map[string]*time.Time{
+		"from": &filter.From,
+		"to":   &filter.To,
+	}
+	for key, dest := range dates {
+		if v := values.Get(key); v != "" {
+			*dest, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				return AuditFilter{}, errors.New("invalid " + key + " parameter, expected an RFC 3339 date")
+			}
+		}
+	}
+	filter.Action = values.Get("action")
+	filter.Result = values.Get("result")
+	return filter, nil
+}
+
+// Query returns the entries matching the filter, most recent first
+func (a *AuditLog) Query(filter AuditFilter) ([]AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entries := []AuditEntry{}
+	file, err := os.Open(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		if filter.match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
+
+func writeAuditCsv(w http.ResponseWriter, entries []AuditEntry) error {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=audit.csv")
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"time", "requestId", "actorId", "userId", "eventId", "action", "result", "error", "reason", "ip", "userAgent"})
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err = writer.Write([]string{
+			entry.Time.Format(time.RFC3339),
+			escapeFormula(entry.RequestId),
+			strconv.Itoa(entry.ActorId),
+			strconv.Itoa(entry.UserId),
+			strconv.Itoa(entry.EventId),
+			entry.Action,
+			entry.Result,
+			// the error, the reason and the user agent come from clients or from Ytrack
+			escapeFormula(entry.Error),
+			escapeFormula(entry.Reason),
+			entry.Ip,
+			escapeFormula(entry.UserAgent),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeAuditJsonl(w http.ResponseWriter, entries []AuditEntry) error {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=audit.jsonl")
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditLogHandler lists the audit trail, the format parameter selects json (default), csv or jsonl
+func auditLogHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	entries, err := auditLog.Query(filter)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		// entries are sorted newest first
+		if len(entries) > 0 {
+			setLastModified(w, entries[0].Time)
+		}
+		returnJson(w, r, entries)
+	case "csv":
+		err = writeAuditCsv(w, entries)
+	case "jsonl":
+		err = writeAuditJsonl(w, entries)
+	default:
+		returnJsonError(w, r, errors.New("unsupported format, expected json, csv or jsonl"), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "response write failed", "error", err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteAuditCsvEscapesFormulas(t *testing.T) {
+	w := httptest.NewRecorder()
+	entry := AuditEntry{
+		Time:      time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		RequestId: "@id",
+		ActorId:   1,
+		UserId:    2,
+		EventId:   3,
+		Action:    AuditActionRegister,
+		Result:    "error",
+		Error:     "-upstream",
+		Reason:    "=HYPERLINK(\"http://example.com\")",
+		Ip:        "192.0.2.1",
+		UserAgent: "\t+cmd",
+	}
+	if err := writeAuditCsv(w, []AuditEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, expected a header and an entry", len(records))
+	}
+	expected := map[int]string{1: "'@id", 7: "'-upstream", 8: "'=HYPERLINK(\"http://example.com\")", 9: "192.0.2.1", 10: "'\t+cmd"}
+	for column, value := range expected {
+		if records[1][column] != value {
+			t.Errorf("%s: got %q, expected %q", records[0][column], records[1][column], value)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"Ytrack-Manager/cache"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var ErrTokenExpired = errors.New("the token has expired")
+
+// How long a token verified by Ytrack is trusted without asking again, at most until it expires
+const verifiedTokenTtl = 5 * time.Minute
+
+// tokenIdentity is the user a verified token belongs to
+type tokenIdentity struct {
+	Id        int
+	Roles     []string
+	ExpiresAt time.Time
+}
+
+// The tokens verified recently, keyed by their hash so that the tokens themselves are not kept
+var verifiedTokens = cache.New[tokenIdentity](10000, verifiedTokenTtl, 0)
+
+// verifyToken returns the identity of the token once its signature has been checked. The claims of a token
+// can be written by anyone, they are only trusted after Ytrack accepted the token, and never past its expiry.
+func verifyToken(r *http.Request, token string) (tokenIdentity, error) {
+	payload, err := ApiInterface.Decode(token)
+	if err != nil {
+		return tokenIdentity{}, ApiInterface.ErrInvalidToken
+	}
+	exp, ok := payload["exp"].(float64)
+	if !ok {
+		return tokenIdentity{}, fmt.Errorf("%w: the token has no expiry", ApiInterface.ErrInvalidToken)
+	}
+	expiresAt := time.Unix(int64(exp), 0)
+	if !time.Now().Before(expiresAt) {
+		return tokenIdentity{}, ErrTokenExpired
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(hash[:])
+	if identity, ok, fresh := verifiedTokens.Get(key); ok && fresh && time.Now().Before(identity.ExpiresAt) {
+		return identity, nil
+	}
+
+	identity := tokenIdentity{ExpiresAt: expiresAt}
+	if identity.Id, err = ExtractId(token); err != nil {
+		return tokenIdentity{}, fmt.Errorf("%w: %v", ApiInterface.ErrInvalidToken, err)
+	}
+	if identity.Roles, err = ExtractRoles(token); err != nil {
+		return tokenIdentity{}, fmt.Errorf("%w: %v", ApiInterface.ErrInvalidToken, err)
+	}
+	if err = apiClient(r).VerifyToken(token); err != nil {
+		return tokenIdentity{}, err
+	}
+	verifiedTokens.Set(key, identity)
+	return identity, nil
+}
+
+// tokenErrorStatus returns the status matching an error returned by verifyToken, Ytrack failing to answer
+// does not mean the token is invalid
+func tokenErrorStatus(err error) int {
+	if errors.Is(err, ApiInterface.ErrInvalidToken) || errors.Is(err, ErrTokenExpired) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusBadGateway
+}
+
+// verifiedIdentity verifies the token and takes a token from the rate limit bucket of its user. When it
+// returns false the error response has already been written.
+func verifiedIdentity(w http.ResponseWriter, r *http.Request, token string) (tokenIdentity, bool) {
+	identity, err := verifyToken(r, token)
+	if err != nil {
+		returnJsonError(w, r, err, tokenErrorStatus(err))
+		return tokenIdentity{}, false
+	}
+	logUserId(r, identity.Id)
+	if !limitUser(w, r, identity.Id) {
+		return tokenIdentity{}, false
+	}
+	return identity, true
+}
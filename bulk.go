@@ -0,0 +1,291 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// The maximum size of a bulk registration upload
+	maxBulkBodySize = 5 << 20
+	// The maximum number of users in a single bulk registration
+	maxBulkRows = 5000
+
+	BulkStatusRegistered    = "registered"
+	BulkStatusWouldRegister = "would-register"
+	BulkStatusSkipped       = "skipped"
+	BulkStatusFailed        = "failed"
+)
+
+type BulkRow struct {
+	Row    int    `json:"row"`
+	Input  string `json:"input"`
+	UserId int    `json:"userId,omitempty"`
+	Login  string `json:"login,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BulkSummary struct {
+	Total      int `json:"total"`
+	Registered int `json:"registered"`
+	Skipped    int `json:"skipped"`
+	Failed     int `json:"failed"`
+}
+
+type BulkResult struct {
+	CourseId int         `json:"courseId"`
+	DryRun   bool        `json:"dryRun"`
+	Summary  BulkSummary `json:"summary"`
+	Rows     []BulkRow   `json:"rows"`
+}
+
+// parseBulkCsv reads one user id or login per line, an optional header line is skipped
+func parseBulkCsv(body []byte) ([]string, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var inputs []string
+	for i, record := range records {
+		if len(record) == 0 {
+			continue
+		}
+		value := strings.TrimSpace(record[0])
+		if i == 0 {
+			switch strings.ToLower(value) {
+			case "id", "userid", "login":
+				continue
+			}
+		}
+		inputs = append(inputs, value)
+	}
+	return inputs, nil
+}
+
+// parseBulkJson accepts either an array of ids and logins or an object with a users array and a reason
+func parseBulkJson(body []byte) ([]string, string, error) {
+	var payload struct {
+		Users  []json.RawMessage `json:"users"`
+		Reason string            `json:"reason"`
+	}
+	trimmed := bytes.TrimSpace(body)
+	var err error
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &payload.Users)
+	} else {
+		err = json.Unmarshal(trimmed, &payload)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	inputs := make([]string, 0, len(payload.Users))
+	for _, raw := range payload.Users {
+		var login string
+		if err := json.Unmarshal(raw, &login); err == nil {
+			inputs = append(inputs, strings.TrimSpace(login))
+			continue
+		}
+		var id int
+		if err := json.Unmarshal(raw, &id); err != nil {
+			return nil, "", fmt.Errorf("invalid user %s, expected an id or a login", raw)
+		}
+		inputs = append(inputs, strconv.Itoa(id))
+	}
+	return inputs, payload.Reason, nil
+}
+
+// resolveBulkRows matches every input with a user, rows that cannot be resolved are marked as failed
+func resolveBulkRows(inputs []string, client *ApiInterface.Client) ([]BulkRow, error) {
+	rows := make([]BulkRow, len(inputs))
+	var ids []int
+	var logins []string
+	for i, input := range inputs {
+		rows[i] = BulkRow{Row: i + 1, Input: input}
+		if input == "" {
+			continue
+		}
+		if id, err := strconv.Atoi(input); err == nil {
+			ids = append(ids, id)
+		} else {
+			logins = append(logins, input)
+		}
+	}
+
+	byId := make(map[int]User)
+	byLogin := make(map[string]User)
+	if len(ids) > 0 || len(logins) > 0 {
+		users, err := GetUsers(ids, logins, client)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			byId[user.Id] = user
+			byLogin[user.Login] = user
+		}
+	}
+
+	for i := range rows {
+		var user User
+		var found bool
+		if id, err := strconv.Atoi(rows[i].Input); err == nil {
+			user, found = byId[id]
+		} else {
+			user, found = byLogin[rows[i].Input]
+		}
+		if !found {
+			rows[i].Status = BulkStatusFailed
+			rows[i].Error = "user not found"
+			continue
+		}
+		rows[i].UserId = user.Id
+		rows[i].Login = user.Login
+	}
+	return rows, nil
+}
+
+// bulkRegisterHandler registers every user of a CSV or JSON upload to the course in a single mutation.
+// Users already registered are skipped so the same file can safely be uploaded again.
+func bulkRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		returnJsonError(w, r, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	courseId, err := pathCourseId(r)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBulkBodySize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		returnJsonError(w, r, errors.New("the body is larger than "+strconv.FormatInt(maxBytesErr.Limit, 10)+" bytes"), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	reason := r.URL.Query().Get("reason")
+	var inputs []string
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		inputs, err = parseBulkCsv(body)
+	case "application/json":
+		var bodyReason string
+		inputs, bodyReason, err = parseBulkJson(body)
+		if bodyReason != "" {
+			reason = bodyReason
+		}
+	default:
+		returnJsonError(w, r, errors.New("unsupported content type, expected text/csv or application/json"), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if len(inputs) == 0 {
+		returnJsonError(w, r, errors.New("no users to register"), http.StatusBadRequest)
+		return
+	}
+	if len(inputs) > maxBulkRows {
+		returnJsonError(w, r, fmt.Errorf("too many users, at most %d can be registered at once", maxBulkRows), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(reason) == "" {
+		returnJsonError(w, r, errors.New("a reason is required"), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := resolveBulkRows(inputs, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	// skip duplicated rows and users that are already registered
+	var userIds []int
+	seen := make(map[int]bool)
+	for _, row := range rows {
+		if row.Status == "" && !seen[row.UserId] {
+			seen[row.UserId] = true
+			userIds = append(userIds, row.UserId)
+		}
+	}
+	registered := make(map[int]bool)
+	if len(userIds) > 0 {
+		registered, err = GetRegisteredUserIds(userIds, courseId, apiClient(r))
+		if err != nil {
+			returnJsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	var pending []int
+	queued := make(map[int]bool)
+	for i, row := range rows {
+		switch {
+		case row.Status != "":
+		case registered[row.UserId]:
+			rows[i].Status = BulkStatusSkipped
+			rows[i].Error = "already registered"
+		case queued[row.UserId]:
+			rows[i].Status = BulkStatusSkipped
+			rows[i].Error = "duplicate row"
+		default:
+			queued[row.UserId] = true
+			pending = append(pending, row.UserId)
+		}
+	}
+
+	result := BulkResult{CourseId: courseId, DryRun: isDryRun(r)}
+	if !result.DryRun && len(pending) > 0 {
+		err = RegisterUsersToCourse(pending, courseId, apiClient(r))
+		for _, userId := range pending {
+			entry := newAuditEntry(r, contextUserId(r), userId, courseId, AuditActionRegister, err)
+			entry.Reason = reason
+			if auditErr := auditLog.Record(entry); auditErr != nil {
+				slog.ErrorContext(r.Context(), "audit log write failed", "error", auditErr)
+			}
+		}
+	}
+	for i, row := range rows {
+		if row.Status == "" {
+			switch {
+			case result.DryRun:
+				rows[i].Status = BulkStatusWouldRegister
+			case err != nil:
+				rows[i].Status = BulkStatusFailed
+				rows[i].Error = err.Error()
+			default:
+				rows[i].Status = BulkStatusRegistered
+			}
+		}
+		switch rows[i].Status {
+		case BulkStatusRegistered, BulkStatusWouldRegister:
+			result.Summary.Registered++
+		case BulkStatusSkipped:
+			result.Summary.Skipped++
+		case BulkStatusFailed:
+			result.Summary.Failed++
+		}
+	}
+	result.Summary.Total = len(rows)
+	result.Rows = rows
+	returnJson(w, r, result)
+}
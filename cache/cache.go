@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stats counts how the lookups of a cache were answered
+type Stats struct {
+	Hits          uint64 `json:"hits"`
+	StaleHits     uint64 `json:"staleHits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	RefreshErrors uint64 `json:"refreshErrors"`
+	Size          int    `json:"size"`
+}
+
+type entry[V any] struct {
+	Key       string    `json:"key"`
+	Value     V         `json:"value"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Cache is an LRU cache whose entries are fresh for ttl, then served stale for staleTtl while
+// they are refreshed in the background
+type Cache[V any] struct {
+	mu         sync.Mutex
+	capacity   int
+	ttl        time.Duration
+	staleTtl   time.Duration
+	items      map[string]*list.Element
+	order      *list.List
+	refreshing map[string]bool
+	stats      Stats
+	// incremented on every invalidation so that loads started before it are not stored
+	generation uint64
+	// replaced in tests to control the expiration
+	now func() time.Time
+}
+
+func New[V any](capacity int, ttl time.Duration, staleTtl time.Duration) *Cache[V] {
+	return &Cache[V]{
+		capacity:   capacity,
+		ttl:        ttl,
+		staleTtl:   staleTtl,
+		items:      make(map[string]*list.Element),
+		order:      list.New(),
+		refreshing: make(map[string]bool),
+		now:        time.Now,
+	}
+}
+
+// lookup returns the entry of the key if it can still be served, it must be called with the lock held
+func (c *Cache[V]) lookup(key string) (*entry[V], bool) {
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := element.Value.(*entry[V])
+	if c.now().After(e.ExpiresAt.Add(c.staleTtl)) {
+		c.order.Remove(element)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return e, true
+}
+
+// Get returns the value of the key and whether it is still fresh
+func (c *Cache[V]) Get(key string) (V, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.lookup(key)
+	if !ok {
+		var zero V
+		return zero, false, false
+	}
+	return e.Value, true, c.now().Before(e.ExpiresAt)
+}
+
+func (c *Cache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, value, c.now().Add(c.ttl))
+}
+
+func (c *Cache[V]) set(key string, value V, expiresAt time.Time) {
+	if element, ok := c.items[key]; ok {
+		e := element.Value.(*entry[V])
+		e.Value = value
+		e.ExpiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+	c.items[key] = c.order.PushFront(&entry[V]{Key: key, Value: value, ExpiresAt: expiresAt})
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[V]).Key)
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if element, ok := c.items[key]; ok {
+		c.order.Remove(element)
+		delete(c.items, key)
+	}
+}
+
+// Purge removes every entry
+func (c *Cache[V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// GetOrLoad returns the cached value of the key or loads it. A miss is loaded with ctx, a stale value
+// is returned right away and refreshed in the background with a copy of ctx that is never cancelled.
+// Only one refresh runs at a time for a key.
+func (c *Cache[V]) GetOrLoad(ctx context.Context, key string, load func(ctx context.Context) (V, error)) (V, error) {
+	c.mu.Lock()
+	generation := c.generation
+	e, ok := c.lookup(key)
+	if ok && c.now().Before(e.ExpiresAt) {
+		c.stats.Hits++
+		c.mu.Unlock()
+		return e.Value, nil
+	}
+	if ok {
+		c.stats.StaleHits++
+		value := e.Value
+		if !c.refreshing[key] {
+			c.refreshing[key] = true
+			go c.refresh(context.WithoutCancel(ctx), key, generation, load)
+		}
+		c.mu.Unlock()
+		return value, nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	value, err := load(ctx)
+	if err != nil {
+		return value, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation == generation {
+		c.set(key, value, c.now().Add(c.ttl))
+	}
+	return value, nil
+}
+
+func (c *Cache[V]) refresh(ctx context.Context, key string, generation uint64, load func(ctx context.Context) (V, error)) {
+	value, err := load(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.refreshing, key)
+	if err != nil {
+		c.stats.RefreshErrors++
+		return
+	}
+	if c.generation == generation {
+		c.set(key, value, c.now().Add(c.ttl))
+	}
+}
+
+func (c *Cache[V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.order.Len()
+	return stats
+}
+
+// Save writes the entries to a JSON file so they survive a restart
+func (c *Cache[V]) Save(path string) error {
+	c.mu.Lock()
+	entries := make([]*entry[V], 0, c.order.Len())
+	for element := c.order.Back(); element != nil; element = element.Prev() {
+		entries = append(entries, element.Value.(*entry[V]))
+	}
+	data, err := json.Marshal(entries)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Load restores the entries saved by Save with their original expiration, a missing file is ignored
+func (c *Cache[V]) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []*entry[V]
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for _, e := range entries {
+		if now.Before(e.ExpiresAt.Add(c.staleTtl)) {
+			c.set(e.Key, e.Value, e.ExpiresAt)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestCache returns a cache whose clock is moved with the returned function
+func newTestCache(capacity int) (*Cache[string], func(time.Duration)) {
+	c := New[string](capacity, time.Minute, time.Minute)
+	now := start
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) { now = start.Add(d) }
+}
+
+// waitRefresh waits for the background refresh of key to finish
+func waitRefresh(t *testing.T, c *Cache[string], key string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		refreshing := c.refreshing[key]
+		c.mu.Unlock()
+		if !refreshing {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("refresh of %q did not finish", key)
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name  string
+		at    time.Duration
+		ok    bool
+		fresh bool
+	}{
+		{"fresh", 30 * time.Second, true, true},
+		{"stale", 90 * time.Second, true, false},
+		{"expired", 3 * time.Minute, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, setClock := newTestCache(10)
+			c.Set("a", "value")
+			setClock(test.at)
+			value, ok, fresh := c.Get("a")
+			if ok != test.ok || fresh != test.fresh {
+				t.Errorf("got ok %v fresh %v, expected %v %v", ok, fresh, test.ok, test.fresh)
+			}
+			if ok && value != "value" {
+				t.Errorf("got %q, expected value", value)
+			}
+			if !ok && c.Stats().Size != 0 {
+				t.Errorf("the expired entry was not removed")
+			}
+		})
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		at        time.Duration
+		value     string
+		stats     Stats
+		refreshed bool
+	}{
+		{"fresh", 30 * time.Second, "old", Stats{Hits: 1, Size: 1}, false},
+		{"stale", 90 * time.Second, "old", Stats{StaleHits: 1, Size: 1}, true},
+		{"expired", 3 * time.Minute, "new", Stats{Misses: 1, Size: 1}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, setClock := newTestCache(10)
+			c.Set("a", "old")
+			setClock(test.at)
+			value, err := c.GetOrLoad(context.Background(), "a", func(ctx context.Context) (string, error) {
+				return "new", nil
+			})
+			if err != nil || value != test.value {
+				t.Fatalf("got %q %v, expected %q", value, err, test.value)
+			}
+			waitRefresh(t, c, "a")
+			if stats := c.Stats(); stats != test.stats {
+				t.Errorf("got stats %+v, expected %+v", stats, test.stats)
+			}
+			if value, _, fresh := c.Get("a"); test.refreshed && (value != "new" || !fresh) {
+				t.Errorf("got %q fresh %v after the refresh, expected the new value", value, fresh)
+			}
+		})
+	}
+}
+
+func TestGetOrLoadDoesNotCacheErrors(t *testing.T) {
+	c, _ := newTestCache(10)
+	failure := errors.New("failure")
+	_, err := c.GetOrLoad(context.Background(), "a", func(ctx context.Context) (string, error) {
+		return "", failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("got %v, expected the load error", err)
+	}
+	if _, ok, _ := c.Get("a"); ok {
+		t.Errorf("the failed load was cached")
+	}
+}
+
+func TestStaleRefreshIsDetached(t *testing.T) {
+	c, setClock := newTestCache(10)
+	c.Set("a", "old")
+	setClock(90 * time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan error, 1)
+	c.GetOrLoad(ctx, "a", func(ctx context.Context) (string, error) {
+		done <- ctx.Err()
+		return "new", nil
+	})
+	if err := <-done; err != nil {
+		t.Errorf("the refresh context is cancelled with the request: %v", err)
+	}
+}
+
+func TestEvictionOrder(t *testing.T) {
+	c, _ := newTestCache(2)
+	c.Set("a", "a")
+	c.Set("b", "b")
+	// reading a makes b the least recently used entry
+	c.Get("a")
+	c.Set("c", "c")
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok, _ := c.Get(key); ok != expected {
+			t.Errorf("%s cached %v, expected %v", key, ok, expected)
+		}
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Size != 2 {
+		t.Errorf("got %d evictions and size %d, expected 1 and 2", stats.Evictions, stats.Size)
+	}
+}
+
+func TestPurgeDuringRefresh(t *testing.T) {
+	c, setClock := newTestCache(10)
+	c.Set("a", "old")
+	setClock(90 * time.Second)
+	started, release := make(chan bool), make(chan bool)
+	value, _ := c.GetOrLoad(context.Background(), "a", func(ctx context.Context) (string, error) {
+		started <- true
+		<-release
+		return "new", nil
+	})
+	if value != "old" {
+		t.Fatalf("got %q, expected the stale value", value)
+	}
+	<-started
+	c.Purge()
+	release <- true
+	waitRefresh(t, c, "a")
+	if value, ok, _ := c.Get("a"); ok {
+		t.Errorf("the refresh started before the purge stored %q", value)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	c, setClock := newTestCache(10)
+	c.Set("expired", "expired")
+	setClock(2 * time.Minute)
+	c.Set("stale", "stale")
+	setClock(3 * time.Minute)
+	c.Set("fresh", "fresh")
+	path := filepath.Join(t.TempDir(), "cache.json")
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// at 3m30s the first entry is past its stale ttl and the second one is stale
+	loaded, setLoadedClock := newTestCache(10)
+	setLoadedClock(3*time.Minute + 30*time.Second)
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key   string
+		ok    bool
+		fresh bool
+	}{
+		{"expired", false, false},
+		{"stale", true, false},
+		{"fresh", true, true},
+	}
+	for _, test := range tests {
+		value, ok, fresh := loaded.Get(test.key)
+		if ok != test.ok || fresh != test.fresh || (ok && value != test.key) {
+			t.Errorf("%s: got %q ok %v fresh %v, expected ok %v fresh %v", test.key, value, ok, fresh, test.ok, test.fresh)
+		}
+	}
+}
+
+func TestLoadIgnoresMissingFile(t *testing.T) {
+	c, _ := newTestCache(10)
+	if err := c.Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("got %v, expected a missing file to be ignored", err)
+	}
+}
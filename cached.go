@@ -0,0 +1,125 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"Ytrack-Manager/cache"
+	"Ytrack-Manager/tools"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// The campus structure and the course lists rarely change, they are cached per campus name
+var campusCache *cache.Cache[ApiInterface.Campus]
+var coursesCache *cache.Cache[[]Course]
+
+// Pages of the course list are cached by campus name and query parameters
+var coursePageCache *cache.Cache[CoursePage]
+
+// The expanded campus trees are cached by campus name, depth and attrs, each one costs a query per level
+var campusTreeCache *cache.Cache[*ObjectNode]
+
+var cacheConfig tools.CacheConfig
+
+// loadCaches creates the caches and restores the entries saved on the last shutdown
+func loadCaches(config tools.CacheConfig) {
+	cacheConfig = config
+	ttl := time.Duration(config.TtlSeconds) * time.Second
+	stale := time.Duration(config.StaleSeconds) * time.Second
+	campusCache = cache.New[ApiInterface.Campus](config.Capacity, ttl, stale)
+	coursesCache = cache.New[[]Course](config.Capacity, ttl, stale)
+	coursePageCache = cache.New[CoursePage](config.Capacity, ttl, stale)
+	campusTreeCache = cache.New[*ObjectNode](config.Capacity, ttl, stale)
+	if config.PersistDir == "" {
+		return
+	}
+	if err := campusCache.Load(filepath.Join(config.PersistDir, "campus-cache.json")); err != nil {
+		slog.Warn("campus cache not loaded", "error", err)
+	}
+	if err := coursesCache.Load(filepath.Join(config.PersistDir, "courses-cache.json")); err != nil {
+		slog.Warn("courses cache not loaded", "error", err)
+	}
+}
+
+// saveCaches writes the caches to the persistence directory when one is configured
+func saveCaches() {
+	if cacheConfig.PersistDir == "" {
+		return
+	}
+	if err := campusCache.Save(filepath.Join(cacheConfig.PersistDir, "campus-cache.json")); err != nil {
+		slog.Error("campus cache not saved", "error", err)
+	}
+	if err := coursesCache.Save(filepath.Join(cacheConfig.PersistDir, "courses-cache.json")); err != nil {
+		slog.Error("courses cache not saved", "error", err)
+	}
+}
+
+// GetCachedCampus returns the cached campus. Like the other cached getters it loads a miss with the
+// context of client, usually the request one from apiClient, and refreshes a stale value with a
+// detached copy of that context so the refresh outlives the request
+func GetCachedCampus(campusName string, client *ApiInterface.Client) (ApiInterface.Campus, error) {
+	return campusCache.GetOrLoad(client.Context(), campusName, func(ctx context.Context) (ApiInterface.Campus, error) {
+		return client.WithContext(ctx).GetCampus(campusName)
+	})
+}
+
+// GetCachedCampusCourses returns the cached course list, callers must not modify it
+func GetCachedCampusCourses(campusName string, client *ApiInterface.Client) ([]Course, error) {
+	return coursesCache.GetOrLoad(client.Context(), campusName, func(ctx context.Context) ([]Course, error) {
+		return GetCampusCourses(campusName, client.WithContext(ctx))
+	})
+}
+
+func GetCachedCampusCoursePage(campusName string, q CourseQuery, client *ApiInterface.Client) (CoursePage, error) {
+	return coursePageCache.GetOrLoad(client.Context(), q.cacheKey(campusName), func(ctx context.Context) (CoursePage, error) {
+		return GetCampusCoursePage(campusName, q, client.WithContext(ctx))
+	})
+}
+
+// GetCachedCampusTree returns the cached campus tree, callers must not modify it
+func GetCachedCampusTree(campusName string, depth int, withAttrs bool, client *ApiInterface.Client) (*ObjectNode, error) {
+	key := campusName + "|" + strconv.Itoa(depth) + "|" + strconv.FormatBool(withAttrs)
+	return campusTreeCache.GetOrLoad(client.Context(), key, func(ctx context.Context) (*ObjectNode, error) {
+		return GetCampusTree(campusName, depth, withAttrs, client.WithContext(ctx))
+	})
+}
+
+// invalidateCourseCaches drops the cached course lists after a registration changed
+func invalidateCourseCaches() {
+	if coursesCache != nil {
+		coursesCache.Purge()
+		coursePageCache.Purge()
+	}
+}
+
+type CacheStats struct {
+	Campus      cache.Stats `json:"campus"`
+	Courses     cache.Stats `json:"courses"`
+	CoursePages cache.Stats `json:"coursePages"`
+	CampusTrees cache.Stats `json:"campusTrees"`
+}
+
+// cacheHandler returns the hit and miss counters of the caches with GET and empties them with DELETE
+func cacheHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		returnJson(w, r, CacheStats{
+			Campus:      campusCache.Stats(),
+			Courses:     coursesCache.Stats(),
+			CoursePages: coursePageCache.Stats(),
+			CampusTrees: campusTreeCache.Stats(),
+		})
+	case "DELETE":
+		campusCache.Purge()
+		coursesCache.Purge()
+		coursePageCache.Purge()
+		campusTreeCache.Purge()
+		returnJson(w, r, Message{Message: "Caches purged"})
+	default:
+		returnJsonError(w, r, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+	}
+}
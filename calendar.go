@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidFeedToken = errors.New("invalid or revoked calendar token")
+
+// FeedTokenStore keeps the calendar feed token of every user. Calendar applications cannot send the x-token
+// header, so each user gets a signed token to put in the feed url. Only the latest token issued to a user is
+// valid, issuing a new one or revoking it invalidates the previous url.
+type FeedTokenStore struct {
+	path string
+	mu   sync.Mutex
+	// The key used to sign the tokens
+	Secret string `json:"secret"`
+	// The nonce of the current token of every user
+	Nonces map[int]string `json:"nonces"`
+}
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// LoadFeedTokenStore reads the store from its file, a new store with a random secret is created if it does not exist
+func LoadFeedTokenStore(path string) (*FeedTokenStore, error) {
+	store := &FeedTokenStore{path: path, Nonces: make(map[int]string)}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err = json.Unmarshal(data, store); err != nil {
+			return nil, err
+		}
+		if store.Nonces == nil {
+			store.Nonces = make(map[int]string)
+		}
+		return store, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	store.Secret, err = randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	return store, store.save()
+}
+
+func (s *FeedTokenStore) save() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+func (s *FeedTokenStore) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(s.Secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issue creates a new token for the user, the previous one stops working
+func (s *FeedTokenStore) Issue(userId int) (string, error) {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Nonces[userId] = nonce
+	if err = s.save(); err != nil {
+		return "", err
+	}
+	payload := strconv.Itoa(userId) + "." + nonce
+	return payload + "." + s.sign(payload), nil
+}
+
+// Revoke invalidates the token of the user
+func (s *FeedTokenStore) Revoke(userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Nonces, userId)
+	return s.save()
+}
+
+// Verify returns the id of the user the token was issued to
+func (s *FeedTokenStore) Verify(token string) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, ErrInvalidFeedToken
+	}
+	userId, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, ErrInvalidFeedToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(parts[0]+"."+parts[1]))) {
+		return 0, ErrInvalidFeedToken
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if nonce, ok := s.Nonces[userId]; !ok || !hmac.Equal([]byte(nonce), []byte(parts[1])) {
+		return 0, ErrInvalidFeedToken
+	}
+	return userId, nil
+}
+
+// icsEscape escapes the characters that have a meaning in iCalendar text values
+func icsEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// icsLine writes a content line folded to 75 octets as required by RFC 5545, without splitting UTF-8 characters
+func icsLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// the leading space of the continuation line counts in its length
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// writeCalendar writes the courses as an iCalendar feed, courses without a start date are left out.
+// The UID of an event only depends on the course id so calendar applications update existing entries.
+func writeCalendar(w io.Writer, name string, courses []Course) error {
+	var b strings.Builder
+	now := icsTime(time.Now())
+	icsLine(&b, "BEGIN:VCALENDAR")
+	icsLine(&b, "VERSION:2.0")
+	icsLine(&b, "PRODID:-//Ytrack Manager//Courses//EN")
+	icsLine(&b, "CALSCALE:GREGORIAN")
+	icsLine(&b, "METHOD:PUBLISH")
+	icsLine(&b, "X-WR-CALNAME:"+icsEscape(name))
+	for _, course := range courses {
+		if course.StartAt == nil {
+			continue
+		}
+		icsLine(&b, "BEGIN:VEVENT")
+		icsLine(&b, fmt.Sprintf("UID:course-%d@%s", course.Id, platformConfig.Domain))
+		icsLine(&b, "DTSTAMP:"+now)
+		icsLine(&b, "DTSTART:"+icsTime(*course.StartAt))
+		if course.EndAt != nil {
+			icsLine(&b, "DTEND:"+icsTime(*course.EndAt))
+		}
+		icsLine(&b, "SUMMARY:"+icsEscape(course.Name))
+		icsLine(&b, "DESCRIPTION:"+icsEscape("Campus: "+course.Campus))
+		icsLine(&b, "END:VEVENT")
+	}
+	icsLine(&b, "END:VCALENDAR")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func returnCalendar(w http.ResponseWriter, name string, courses []Course) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline; filename=courses.ics")
+	if err := writeCalendar(w, name, courses); err != nil {
+		slog.Warn("calendar write failed", "error", err)
+	}
+}
+
+// CalendarToken is a feed token with the url to subscribe to
+type CalendarToken struct {
+	Token string `json:"token"`
+	Url   string `json:"url"`
+}
+
+// feedUrl returns the absolute url of the user feed for the token, under the same version prefix as the
+// token request so that a legacy alias hands out the unprefixed feed. X-Forwarded-Proto is only read from
+// trusted proxies.
+func feedUrl(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || (fromTrustedProxy(r) && r.Header.Get("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+	prefix := strings.TrimSuffix(r.URL.Path, "/user/calendar/token")
+	return scheme + "://" + r.Host + prefix + "/user/calendar.ics?token=" + url.QueryEscape(token)
+}
+
+// calendarTokenHandler issues a new feed token with POST and revokes the current one with DELETE
+func calendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userId := contextUserId(r)
+	switch r.Method {
+	case "POST":
+		token, err := feedTokens.Issue(userId)
+		if err != nil {
+			returnJsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		returnJson(w, r, CalendarToken{
+			Token: token,
+			Url:   feedUrl(r, token),
+		})
+	case "DELETE":
+		if err := feedTokens.Revoke(userId); err != nil {
+			returnJsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		returnJson(w, r, Message{Message: "Calendar token revoked"})
+	default:
+		returnJsonError(w, r, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+	}
+}
+
+// userCalendarHandler serves the courses of the user the feed token belongs to
+func userCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := feedTokens.Verify(r.URL.Query().Get("token"))
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusUnauthorized)
+		return
+	}
+	courses, err := GetUserCourses(platformConfig.CampusName, userId, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, upstreamErrorStatus(err))
+		return
+	}
+	returnCalendar(w, "My courses", courses)
+}
+
+// campusCalendarHandler serves the courses of the campus that are not over yet
+func campusCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	courses, err := GetCachedCampusCourses(platformConfig.CampusName, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, upstreamErrorStatus(err))
+		return
+	}
+	now := time.Now()
+	var upcoming []Course
+	for _, course := range courses {
+		end := course.EndAt
+		if end == nil {
+			end = course.StartAt
+		}
+		if end != nil && end.After(now) {
+			upcoming = append(upcoming, course)
+		}
+	}
+	returnCalendar(w, platformConfig.CampusName+" courses", upcoming)
+}
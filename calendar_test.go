@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFeedUrl(t *testing.T) {
+	if err := setupTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	defer setupTrustedProxies(nil)
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		proto      string
+		expected   string
+	}{
+		{"direct client", "/v1/user/calendar/token", "203.0.113.5:4000", "", "http://example.com/v1/user/calendar.ics?token=a%2Bb"},
+		{"spoofed scheme", "/v1/user/calendar/token", "203.0.113.5:4000", "https", "http://example.com/v1/user/calendar.ics?token=a%2Bb"},
+		{"trusted proxy", "/v1/user/calendar/token", "10.1.2.3:4000", "https", "https://example.com/v1/user/calendar.ics?token=a%2Bb"},
+		{"legacy alias", "/user/calendar/token", "203.0.113.5:4000", "", "http://example.com/user/calendar.ics?token=a%2Bb"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "http://example.com"+test.path, nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+		if url := feedUrl(r, "a+b"); url != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.name, url, test.expected)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const (
+	defaultTreeDepth = 2
+	maxTreeDepth     = 10
+	// The maximum number of nodes returned in a single tree, deeper levels are left out once it is reached
+	maxTreeNodes = 5000
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+type ObjectNode struct {
+	Id       int                    `json:"id"`
+	Name     string                 `json:"name"`
+	Type     string                 `json:"type"`
+	Key      string                 `json:"key,omitempty"`
+	Index    int                    `json:"index"`
+	Attrs    map[string]interface{} `json:"attrs,omitempty"`
+	Children []*ObjectNode          `json:"children,omitempty"`
+	links    []ObjectLink
+}
+
+// ObjectLink is the position of a child object under its parent
+type ObjectLink struct {
+	ParentId int
+	ChildId  int
+	Key      string
+	Index    int
+}
+
+// GetObjects returns the objects with the given ids and the links to their children ordered by index
+func GetObjects(ids []int, client *ApiInterface.Client) (map[int]*ObjectNode, error) {
+	query, err := loadQueryFromFile("queries/get_objects.graphql")
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.Run(query, map[string]interface{}{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+	objects := make(map[int]*ObjectNode)
+	for _, v := range data["object"].([]interface{}) {
+		object := v.(map[string]interface{})
+		node := &ObjectNode{Id: int(object["id"].(float64))}
+		node.Name, _ = object["name"].(string)
+		node.Type, _ = object["type"].(string)
+		node.Attrs, _ = object["attrs"].(map[string]interface{})
+		objects[node.Id] = node
+	}
+	for _, v := range data["object_child"].([]interface{}) {
+		child := v.(map[string]interface{})
+		link := ObjectLink{
+			ParentId: int(child["parentId"].(float64)),
+			ChildId:  int(child["childId"].(float64)),
+		}
+		link.Key, _ = child["key"].(string)
+		index, _ := child["index"].(float64)
+		link.Index = int(index)
+		if parent, ok := objects[link.ParentId]; ok {
+			parent.links = append(parent.links, link)
+		}
+	}
+	return objects, nil
+}
+
+// expandObjects fetches the children of the nodes level by level, one query per level,
+// until depth levels were added or the node limit is reached
+func expandObjects(level []*ObjectNode, depth int, withAttrs bool, client *ApiInterface.Client) error {
+	count := len(level)
+	for d := 0; d < depth && len(level) > 0 && count < maxTreeNodes; d++ {
+		var ids []int
+		for _, node := range level {
+			for _, link := range node.links {
+				ids = append(ids, link.ChildId)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		objects, err := GetObjects(ids, client)
+		if err != nil {
+			return err
+		}
+		var next []*ObjectNode
+		for _, node := range level {
+			for _, link := range node.links {
+				object, ok := objects[link.ChildId]
+				if !ok || count >= maxTreeNodes {
+					continue
+				}
+				// the same object can appear under several parents, each occurrence gets its own node
+				child := *object
+				child.Key = link.Key
+				child.Index = link.Index
+				if !withAttrs {
+					child.Attrs = nil
+				}
+				node.Children = append(node.Children, &child)
+				next = append(next, &child)
+				count++
+			}
+		}
+		level = next
+	}
+	return nil
+}
+
+// parseDepth reads the depth parameter
+func parseDepth(r *http.Request, defaultDepth int) (int, error) {
+	v := r.URL.Query().Get("depth")
+	if v == "" {
+		return defaultDepth, nil
+	}
+	depth, err := strconv.Atoi(v)
+	if err != nil || depth < 0 || depth > maxTreeDepth {
+		return 0, errors.New("invalid depth parameter, expected a number between 0 and " + strconv.Itoa(maxTreeDepth))
+	}
+	return depth, nil
+}
+
+// GetCampusTree builds the object hierarchy of the campus down to depth levels
+func GetCampusTree(campusName string, depth int, withAttrs bool, client *ApiInterface.Client) (*ObjectNode, error) {
+	campus, err := GetCachedCampus(campusName, client)
+	if err != nil {
+		return nil, err
+	}
+	root := &ObjectNode{Id: campus.Id, Name: campus.Name, Type: campus.Type}
+	if withAttrs {
+		root.Attrs = campus.Attrs
+	}
+	for _, child := range campus.Children {
+		root.links = append(root.links, ObjectLink{ParentId: campus.Id, ChildId: child.Id, Key: child.Name, Index: child.Index})
+	}
+	sort.Slice(root.links, func(i, j int) bool {
+		return root.links[i].Index < root.links[j].Index
+	})
+	if err = expandObjects([]*ObjectNode{root}, depth, withAttrs, client); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// campusTreeHandler returns the object hierarchy of the campus, ?depth limits the number of levels
+// and ?attrs=true adds the attributes of every node. Like objectHandler, the attributes are only
+// returned to authenticated users and such responses are private.
+func campusTreeHandler(w http.ResponseWriter, r *http.Request) {
+	depth, err := parseDepth(r, defaultTreeDepth)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	withAttrs, _ := strconv.ParseBool(r.URL.Query().Get("attrs"))
+	if withAttrs {
+		w.Header().Set("Cache-Control", privateCacheControl)
+		if _, _, ok := authenticate(w, r); !ok {
+			return
+		}
+	}
+	root, err := GetCachedCampusTree(platformConfig.CampusName, depth, withAttrs, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, upstreamErrorStatus(err))
+		return
+	}
+	returnJson(w, r, root)
+}
+
+// objectHandler returns an object with its attributes and its children, ?depth sets the number of levels of children.
+// The objects are read with the service token, so only authenticated users can look them up
+func objectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		returnJsonError(w, r, errors.New("invalid object id"), http.StatusBadRequest)
+		return
+	}
+	depth, err := parseDepth(r, 1)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	objects, err := GetObjects([]int{id}, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	object, ok := objects[id]
+	if !ok {
+		returnJsonError(w, r, ErrObjectNotFound, http.StatusNotFound)
+		return
+	}
+	withAttrs, _ := strconv.ParseBool(r.URL.Query().Get("attrs"))
+	if err = expandObjects([]*ObjectNode{object}, depth, withAttrs, apiClient(r)); err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	returnJson(w, r, object)
+}
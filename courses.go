@@ -0,0 +1,289 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCoursesLimit = 50
+	maxCoursesLimit     = 500
+)
+
+// The fields the course list can be sorted by, mapped to the Hasura column they are read from
+var courseSortFields = map[string]string{"id": "id", "name": "name", "startAt": "startAt"}
+
+// CourseQuery holds the pagination, sorting and filtering parameters of the course list
+type CourseQuery struct {
+	Limit  int
+	Offset int
+	Cursor *courseCursor
+	// Sort is one of the courseSortFields, Desc reverses the order
+	Sort   string
+	Desc   bool
+	Search string
+	// StartFrom and StartTo restrict the courses to the ones starting in [StartFrom, StartTo)
+	StartFrom *time.Time
+	StartTo   *time.Time
+}
+
+// courseCursor points after the last course of a page, it is handed to clients as an opaque string
+type courseCursor struct {
+	Sort string  `json:"s"`
+	Desc bool    `json:"d,omitempty"`
+	Id   int     `json:"id"`
+	Key  *string `json:"k,omitempty"`
+}
+
+type CoursePage struct {
+	Courses    []Course   `json:"courses"`
+	Pagination Pagination `json:"pagination"`
+}
+
+func (c courseCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCourseCursor(value string) (*courseCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor courseCursor
+	if err = json.Unmarshal(data, &cursor); err != nil || cursor.Id <= 0 {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// parseDateParameter accepts a RFC 3339 timestamp or a plain date
+func parseDateParameter(values url.Values, name string) (*time.Time, error) {
+	value := values.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, value)
+	}
+	if err != nil {
+		return nil, errors.New("invalid " + name + " parameter, expected a date like 2024-09-01 or a RFC 3339 timestamp")
+	}
+	return &t, nil
+}
+
+// parseCourseQuery reads the limit, offset, cursor, sort, q, startFrom and startTo parameters
+func parseCourseQuery(values url.Values) (CourseQuery, error) {
+	var q CourseQuery
+	var err error
+	q.Limit, q.Offset, err = parsePagination(values, defaultCoursesLimit, maxCoursesLimit)
+	if err != nil {
+		return CourseQuery{}, err
+	}
+	q.Sort = strings.TrimPrefix(values.Get("sort"), "-")
+	q.Desc = strings.HasPrefix(values.Get("sort"), "-")
+	if q.Sort == "" {
+		q.Sort = "id"
+	}
+	if _, ok := courseSortFields[q.Sort]; !ok {
+		return CourseQuery{}, errors.New("invalid sort parameter, expected id, name or startAt, prefixed with - for descending order")
+	}
+	if v := values.Get("cursor"); v != "" {
+		if q.Offset > 0 {
+			return CourseQuery{}, errors.New("the cursor and offset parameters cannot be combined")
+		}
+		q.Cursor, err = decodeCourseCursor(v)
+		if err != nil {
+			return CourseQuery{}, err
+		}
+		if q.Cursor.Sort != q.Sort || q.Cursor.Desc != q.Desc {
+			return CourseQuery{}, errors.New("the cursor was issued for another sort order")
+		}
+	}
+	q.Search = strings.TrimSpace(values.Get("q"))
+	if q.StartFrom, err = parseDateParameter(values, "startFrom"); err != nil {
+		return CourseQuery{}, err
+	}
+	if q.StartTo, err = parseDateParameter(values, "startTo"); err != nil {
+		return CourseQuery{}, err
+	}
+	return q, nil
+}
+
+// cacheKey identifies the page in the course cache, every parameter changes the result
+func (q CourseQuery) cacheKey(campusName string) string {
+	key := []string{campusName, strconv.Itoa(q.Limit), strconv.Itoa(q.Offset), q.Sort, strconv.FormatBool(q.Desc), q.Search}
+	if q.Cursor != nil {
+		key = append(key, q.Cursor.encode())
+	} else {
+		key = append(key, "")
+	}
+	for _, t := range []*time.Time{q.StartFrom, q.StartTo} {
+		if t != nil {
+			key = append(key, t.UTC().Format(time.RFC3339))
+		} else {
+			key = append(key, "")
+		}
+	}
+	return strings.Join(key, "\x00")
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern so the search matches them literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// sortColumn wraps a comparison on the sort field, the name lives on the event object
+func sortColumn(sort string, comparison interface{}) map[string]interface{} {
+	if sort == "name" {
+		return map[string]interface{}{"object": map[string]interface{}{"name": comparison}}
+	}
+	return map[string]interface{}{courseSortFields[sort]: comparison}
+}
+
+// cursorCondition selects the courses after the cursor. The id breaks the ties and courses without
+// a start date come last whatever the direction.
+func (q CourseQuery) cursorCondition() map[string]interface{} {
+	afterId := map[string]interface{}{"id": map[string]interface{}{"_gt": q.Cursor.Id}}
+	if q.Sort == "id" {
+		if q.Desc {
+			return map[string]interface{}{"id": map[string]interface{}{"_lt": q.Cursor.Id}}
+		}
+		return afterId
+	}
+	if q.Cursor.Key == nil {
+		return map[string]interface{}{"_and": []interface{}{
+			sortColumn(q.Sort, map[string]interface{}{"_is_null": true}),
+			afterId,
+		}}
+	}
+	after := "_gt"
+	if q.Desc {
+		after = "_lt"
+	}
+	conditions := []interface{}{
+		sortColumn(q.Sort, map[string]interface{}{after: *q.Cursor.Key}),
+		map[string]interface{}{"_and": []interface{}{
+			sortColumn(q.Sort, map[string]interface{}{"_eq": *q.Cursor.Key}),
+			afterId,
+		}},
+	}
+	if q.Sort == "startAt" {
+		conditions = append(conditions, sortColumn(q.Sort, map[string]interface{}{"_is_null": true}))
+	}
+	return map[string]interface{}{"_or": conditions}
+}
+
+// variables builds the where, order_by, limit and offset arguments of the course query.
+// One more course than the limit is requested to know whether there is a next page.
+func (q CourseQuery) variables(campusName string) map[string]interface{} {
+	filters := []interface{}{
+		map[string]interface{}{"campus": map[string]interface{}{"_eq": campusName}},
+		map[string]interface{}{"object": map[string]interface{}{"type": map[string]interface{}{"_eq": "piscine"}}},
+	}
+	if q.Search != "" {
+		filters = append(filters, sortColumn("name", map[string]interface{}{"_ilike": "%" + escapeLike(q.Search) + "%"}))
+	}
+	if q.StartFrom != nil {
+		filters = append(filters, map[string]interface{}{"startAt": map[string]interface{}{"_gte": q.StartFrom.Format(time.RFC3339)}})
+	}
+	if q.StartTo != nil {
+		filters = append(filters, map[string]interface{}{"startAt": map[string]interface{}{"_lt": q.StartTo.Format(time.RFC3339)}})
+	}
+	countWhere := map[string]interface{}{"_and": filters}
+	where := countWhere
+	if q.Cursor != nil {
+		where = map[string]interface{}{"_and": append(append([]interface{}{}, filters...), q.cursorCondition())}
+	}
+
+	direction := "asc_nulls_last"
+	if q.Desc {
+		direction = "desc_nulls_last"
+	}
+	orderBy := []interface{}{}
+	if q.Sort != "id" {
+		orderBy = append(orderBy, sortColumn(q.Sort, direction))
+	}
+	idDirection := "asc"
+	if q.Sort == "id" && q.Desc {
+		idDirection = "desc"
+	}
+	orderBy = append(orderBy, map[string]interface{}{"id": idDirection})
+
+	return map[string]interface{}{
+		"where":      where,
+		"countWhere": countWhere,
+		"orderBy":    orderBy,
+		"limit":      q.Limit + 1,
+		"offset":     q.Offset,
+	}
+}
+
+// cursorAfter returns the cursor pointing after the course
+func (q CourseQuery) cursorAfter(course Course) string {
+	cursor := courseCursor{Sort: q.Sort, Desc: q.Desc, Id: course.Id}
+	switch q.Sort {
+	case "name":
+		cursor.Key = &course.Name
+	case "startAt":
+		if course.StartAt != nil {
+			key := course.StartAt.Format(time.RFC3339Nano)
+			cursor.Key = &key
+		}
+	}
+	return cursor.encode()
+}
+
+func GetCampusCoursePage(campusName string, q CourseQuery, client *ApiInterface.Client) (CoursePage, error) {
+	query, err := loadQueryFromFile("queries/queryCampusEventsPage.graphql")
+	if err != nil {
+		return CoursePage{}, err
+	}
+	data, err := client.Run(query, q.variables(campusName))
+	if err != nil {
+		return CoursePage{}, err
+	}
+	page := CoursePage{
+		Courses:    []Course{},
+		Pagination: Pagination{Limit: q.Limit, Offset: q.Offset},
+	}
+	for _, v := range data["event"].([]interface{}) {
+		page.Courses = append(page.Courses, parseCourse(v.(map[string]interface{})))
+	}
+	total, _ := data["event_aggregate"].(map[string]interface{})["aggregate"].(map[string]interface{})["count"].(float64)
+	page.Pagination.Total = int(total)
+	if len(page.Courses) > q.Limit {
+		page.Courses = page.Courses[:q.Limit]
+		page.Pagination.HasMore = true
+		page.Pagination.NextCursor = q.cursorAfter(page.Courses[q.Limit-1])
+	}
+	return page, nil
+}
+
+// campusCoursesHandler lists a page of the campus courses, see parseCourseQuery for the parameters
+func campusCoursesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	q, err := parseCourseQuery(r.URL.Query())
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	page, err := GetCachedCampusCoursePage(platformConfig.CampusName, q, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	returnJsonPage(w, r, page.Courses, page.Pagination)
+}
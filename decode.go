@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The largest JSON body accepted by decodeJsonBody
+const maxJsonBodySize = 64 << 10
+
+// FieldError tells which field of the body is invalid and why
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request body
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+	return "invalid request body: " + strings.Join(messages, ", ")
+}
+
+// decodeJsonBody decodes the JSON body of the request into dest, a pointer to a struct, and checks its
+// validate tags. Unknown fields, trailing data and bodies over maxJsonBodySize are refused. When it returns
+// false the error response has already been written.
+func decodeJsonBody(w http.ResponseWriter, r *http.Request, dest interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJsonBodySize))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(dest)
+	if err == nil {
+		// anything after the object, even a stray closing bracket, is refused
+		if _, tokenErr := decoder.Token(); tokenErr != io.EOF {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(tokenErr, &maxBytesErr) {
+				err = tokenErr
+			} else {
+				err = errors.New("the body must contain a single JSON object")
+			}
+		}
+	}
+	if err == nil {
+		err = validateStruct(dest)
+	}
+	if err == nil {
+		return true
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		returnJsonError(w, r, errors.New("the body is larger than "+strconv.FormatInt(maxBytesErr.Limit, 10)+" bytes"), http.StatusRequestEntityTooLarge)
+		return false
+	case errors.Is(err, io.EOF):
+		err = errors.New("the body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		err = errors.New("the body is truncated")
+	case errors.As(err, &syntaxErr):
+		err = errors.New("malformed JSON at offset " + strconv.FormatInt(syntaxErr.Offset, 10))
+	case errors.As(err, &typeErr):
+		err = &ValidationError{Fields: []FieldError{{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()}}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		err = &ValidationError{Fields: []FieldError{{Field: field, Message: "unknown field"}}}
+	}
+	returnJsonError(w, r, err, http.StatusBadRequest)
+	return false
+}
+
+// validateStruct checks the validate tags of the fields of the struct v points to. The rules are
+// comma separated: required refuses zero values and blank strings, min and max bound numbers and the
+// length of strings and slices.
+func validateStruct(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []FieldError
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		rules := field.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		if message := validateField(value.Field(i), rules); message != "" {
+			fields = append(fields, FieldError{Field: name, Message: message})
+		}
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// validateField returns why the value breaks one of the rules, or an empty string
+func validateField(value reflect.Value, rules string) string {
+	if value.IsZero() || (value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "") {
+		if strings.Contains(","+rules+",", ",required,") {
+			return "is required"
+		}
+		// optional fields are only checked when set
+		return ""
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		key, arg, _ := strings.Cut(rule, "=")
+		if key != "min" && key != "max" {
+			continue
+		}
+		bound, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return "has an invalid " + key + " rule"
+		}
+		var actual float64
+		unit := ""
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			actual = float64(value.Int())
+		case reflect.Float32, reflect.Float64:
+			actual = value.Float()
+		case reflect.String:
+			actual = float64(len([]rune(value.String())))
+			unit = " characters"
+		case reflect.Slice:
+			actual = float64(value.Len())
+			unit = " items"
+		default:
+			continue
+		}
+		if key == "min" && actual < bound {
+			if unit == "" {
+				return "must be at least " + arg
+			}
+			return "must have at least " + arg + unit
+		}
+		if key == "max" && actual > bound {
+			if unit == "" {
+				return "must be at most " + arg
+			}
+			return "must have at most " + arg + unit
+		}
+	}
+	return ""
+}
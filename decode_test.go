@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type decodeTestBody struct {
+	Count int      `json:"count" validate:"required,min=1,max=10"`
+	Name  string   `json:"name" validate:"required,min=2,max=5"`
+	Tags  []string `json:"tags" validate:"min=1,max=2"`
+}
+
+func TestDecodeJsonBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		fields []string
+	}{
+		{"valid", `{"count": 1, "name": "ab", "tags": ["a"]}`, http.StatusOK, nil},
+		{"optional slice left out", `{"count": 10, "name": "abcde"}`, http.StatusOK, nil},
+		{"trailing whitespace", `{"count": 1, "name": "ab"}` + "\n", http.StatusOK, nil},
+		{"required int", `{"name": "ab"}`, http.StatusBadRequest, []string{"count"}},
+		{"required string", `{"count": 1}`, http.StatusBadRequest, []string{"name"}},
+		{"blank string", `{"count": 1, "name": "   "}`, http.StatusBadRequest, []string{"name"}},
+		{"int below min", `{"count": -1, "name": "ab"}`, http.StatusBadRequest, []string{"count"}},
+		{"int above max", `{"count": 11, "name": "ab"}`, http.StatusBadRequest, []string{"count"}},
+		{"string below min", `{"count": 1, "name": "a"}`, http.StatusBadRequest, []string{"name"}},
+		{"string above max", `{"count": 1, "name": "abcdef"}`, http.StatusBadRequest, []string{"name"}},
+		{"string length in runes", `{"count": 1, "name": "ééééé"}`, http.StatusOK, nil},
+		{"slice below min", `{"count": 1, "name": "ab", "tags": []}`, http.StatusBadRequest, []string{"tags"}},
+		{"slice above max", `{"count": 1, "name": "ab", "tags": ["a", "b", "c"]}`, http.StatusBadRequest, []string{"tags"}},
+		{"several fields", `{"count": 0, "name": "abcdef"}`, http.StatusBadRequest, []string{"count", "name"}},
+		{"unknown field", `{"count": 1, "name": "ab", "other": true}`, http.StatusBadRequest, []string{"other"}},
+		{"wrong type", `{"count": "1", "name": "ab"}`, http.StatusBadRequest, []string{"count"}},
+		{"empty body", ``, http.StatusBadRequest, nil},
+		{"truncated body", `{"count": 1`, http.StatusBadRequest, nil},
+		{"malformed body", `{"count": 1,}`, http.StatusBadRequest, nil},
+		{"trailing brace", `{"count": 1, "name": "ab"}}`, http.StatusBadRequest, nil},
+		{"trailing bracket", `{"count": 1, "name": "ab"}]`, http.StatusBadRequest, nil},
+		{"second object", `{"count": 1, "name": "ab"} {}`, http.StatusBadRequest, nil},
+		{"too large", `{"count": 1, "name": "` + strings.Repeat("a", maxJsonBodySize) + `"}`, http.StatusRequestEntityTooLarge, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+			w := httptest.NewRecorder()
+			var body decodeTestBody
+			if decodeJsonBody(w, r, &body) {
+				w.WriteHeader(http.StatusOK)
+			}
+			if w.Code != test.status {
+				t.Fatalf("got status %d, expected %d: %s", w.Code, test.status, w.Body.String())
+			}
+			if test.status == http.StatusOK {
+				return
+			}
+			var problem Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("the error is not a problem: %v", err)
+			}
+			var fields []string
+			for _, field := range problem.Errors {
+				fields = append(fields, field.Field)
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("got invalid fields %v, expected %v", fields, test.fields)
+			}
+		})
+	}
+}
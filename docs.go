@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The Swagger UI assets and the generated OpenAPI document, served at /swagger/
+//
+//go:embed swagger
+var swaggerFiles embed.FS
+
+const docsCacheControl = "public, max-age=3600"
+
+// The extensions worth compressing, the images are already compressed
+var compressibleExtensions = map[string]bool{".html": true, ".css": true, ".js": true, ".json": true, ".map": true}
+
+func init() {
+	// source maps are unknown to the mime package, without it they would be sniffed as text/plain
+	_ = mime.AddExtensionType(".map", "application/json")
+}
+
+// staticAsset holds the ETag of an embedded file and, once requested with gzip, its compressed content
+type staticAsset struct {
+	etag    string
+	once    sync.Once
+	gzipped []byte
+	gzipErr error
+}
+
+// compressed gzips the file on its first use, the compressed representation gets its own ETag
+func (a *staticAsset) compressed(files fs.FS, name string) ([]byte, error) {
+	a.once.Do(func() {
+		var contents []byte
+		contents, a.gzipErr = fs.ReadFile(files, name)
+		if a.gzipErr != nil {
+			return
+		}
+		var b bytes.Buffer
+		writer, _ := gzip.NewWriterLevel(&b, gzip.BestCompression)
+		if _, a.gzipErr = writer.Write(contents); a.gzipErr == nil {
+			a.gzipErr = writer.Close()
+		}
+		a.gzipped = b.Bytes()
+	})
+	return a.gzipped, a.gzipErr
+}
+
+// acceptsGzip reports whether the client listed gzip in Accept-Encoding without refusing it
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) == "gzip" {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// swaggerHandler serves the embedded documentation through http.FileServer, with ETags and a cache lifetime
+// since embedded files have no modification time, and gzip compression of the text assets
+func swaggerHandler() (http.HandlerFunc, error) {
+	files, err := fs.Sub(swaggerFiles, "swagger")
+	if err != nil {
+		return nil, err
+	}
+	assets := map[string]*staticAsset{}
+	err = fs.WalkDir(files, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		contents, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(contents)
+		assets[name] = &staticAsset{etag: base64.RawURLEncoding.EncodeToString(sum[:16])}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fileServer := http.StripPrefix("/swagger/", http.FileServerFS(files))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/swagger/")
+		if name == "" || strings.HasSuffix(name, "/") {
+			name += "index.html"
+		}
+		asset, ok := assets[name]
+		if !ok {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", docsCacheControl)
+		w.Header().Set("ETag", `"`+asset.etag+`"`)
+		extension := path.Ext(name)
+		if !compressibleExtensions[extension] {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) || r.Header.Get("Range") != "" {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		gzipped, err := asset.compressed(files, name)
+		if err != nil {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		// set before ServeContent so it does not sniff the compressed bytes
+		w.Header().Set("Content-Type", mime.TypeByExtension(extension))
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("ETag", `"`+asset.etag+`-gzip"`)
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(gzipped))
+	}, nil
+}
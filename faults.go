@@ -0,0 +1,100 @@
+package main
+
+import (
+	"Ytrack-Manager/tools"
+	"errors"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var errInjectedFault = errors.New("injected fault")
+
+// validateFaultConfig rejects the fault injection settings that would be silently ignored or misbehave
+func validateFaultConfig(faults map[string]tools.FaultConfig) error {
+	for pattern, fault := range faults {
+		switch fault.Latency.Distribution {
+		case "", "fixed", "normal", "exponential":
+		case "uniform":
+			if fault.Latency.MaxMs < fault.Latency.MinMs {
+				return errors.New("fault injection for " + pattern + ": maxMs is lower than minMs")
+			}
+		default:
+			return errors.New("fault injection for " + pattern + ": unknown latency distribution " + fault.Latency.Distribution)
+		}
+		if fault.Latency.MinMs < 0 || fault.Latency.MeanMs < 0 || fault.Latency.StdDevMs < 0 {
+			return errors.New("fault injection for " + pattern + ": latencies must be positive")
+		}
+		if fault.ErrorRate < 0 || fault.ErrorRate > 1 {
+			return errors.New("fault injection for " + pattern + ": errorRate must be between 0 and 1")
+		}
+		for _, status := range fault.StatusCodes {
+			if status < 400 || status > 599 {
+				return errors.New("fault injection for " + pattern + ": invalid status code " + strconv.Itoa(status))
+			}
+		}
+	}
+	return nil
+}
+
+// faultDelay draws the delay of a request from the latency distribution
+func faultDelay(latency tools.LatencyConfig) time.Duration {
+	var ms float64
+	switch latency.Distribution {
+	case "fixed":
+		ms = float64(latency.MeanMs)
+	case "uniform":
+		ms = float64(latency.MinMs) + rand.Float64()*float64(latency.MaxMs-latency.MinMs)
+	case "normal":
+		ms = math.Max(0, float64(latency.MeanMs)+rand.NormFloat64()*float64(latency.StdDevMs))
+	case "exponential":
+		ms = rand.ExpFloat64() * float64(latency.MeanMs)
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// faultInjection delays or fails the requests of the route as configured for its pattern, falling back to
+// the "*" entry. It returns the handler unchanged unless the debug flag is set, so production is never affected.
+func faultInjection(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	if !platformConfig.Debug {
+		return next
+	}
+	fault, ok := platformConfig.FaultInjection[pattern]
+	if !ok {
+		fault, ok = platformConfig.FaultInjection["*"]
+	}
+	if !ok {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		// preflight requests are left alone so the browser still sees the real failures
+		if r.Method == "OPTIONS" {
+			next(w, r)
+			return
+		}
+		select {
+		case <-time.After(faultDelay(fault.Latency)):
+		case <-r.Context().Done():
+			return
+		}
+		if fault.ErrorRate > 0 && rand.Float64() < fault.ErrorRate {
+			status := http.StatusServiceUnavailable
+			if len(fault.StatusCodes) > 0 {
+				status = fault.StatusCodes[rand.IntN(len(fault.StatusCodes))]
+			}
+			returnJsonError(w, r, errInjectedFault, status)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// logFaultInjection warns at startup that requests are being slowed down or failed on purpose
+func logFaultInjection() {
+	if platformConfig.Debug && len(platformConfig.FaultInjection) > 0 {
+		slog.Warn("debug mode: fault injection enabled", "route_patterns", len(platformConfig.FaultInjection))
+	}
+}
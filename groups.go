@@ -0,0 +1,337 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var ErrGroupNotFound = errors.New("group not found")
+
+type GroupMember struct {
+	UserId   int    `json:"userId"`
+	Login    string `json:"login"`
+	Accepted bool   `json:"accepted"`
+}
+
+type Group struct {
+	Id        int           `json:"id"`
+	EventId   int           `json:"eventId"`
+	Path      string        `json:"path"`
+	Status    string        `json:"status"`
+	CaptainId int           `json:"captainId"`
+	Captain   string        `json:"captain"`
+	Members   []GroupMember `json:"members"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+func parseGroup(group map[string]interface{}) Group {
+	parsed := Group{
+		Id:        int(group["id"].(float64)),
+		Members:   []GroupMember{},
+		CreatedAt: timestampOrZero(group["createdAt"]),
+	}
+	eventId, _ := group["eventId"].(float64)
+	captainId, _ := group["captainId"].(float64)
+	parsed.EventId = int(eventId)
+	parsed.CaptainId = int(captainId)
+	parsed.Path, _ = group["path"].(string)
+	parsed.Status, _ = group["status"].(string)
+	parsed.Captain, _ = group["captainLogin"].(string)
+	for _, m := range group["members"].([]interface{}) {
+		member := m.(map[string]interface{})
+		groupMember := GroupMember{UserId: int(member["userId"].(float64))}
+		groupMember.Login, _ = member["userLogin"].(string)
+		groupMember.Accepted, _ = member["accepted"].(bool)
+		parsed.Members = append(parsed.Members, groupMember)
+	}
+	return parsed
+}
+
+// getGroups runs one of the group queries and parses the groups it returns
+func getGroups(queryFile string, variables map[string]interface{}, client *ApiInterface.Client) ([]Group, error) {
+	query, err := loadQueryFromFile(queryFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.Run(query, variables)
+	if err != nil {
+		return nil, err
+	}
+	groups := []Group{}
+	for _, v := range data["group"].([]interface{}) {
+		groups = append(groups, parseGroup(v.(map[string]interface{})))
+	}
+	return groups, nil
+}
+
+// GetUserGroups returns the groups the user is a member of on the given events
+func GetUserGroups(campusName string, userId int, eventIds []int, client *ApiInterface.Client) ([]Group, error) {
+	return getGroups("queries/get_user_groups.graphql", map[string]interface{}{"campusName": campusName, "userID": userId, "eventIds": eventIds}, client)
+}
+
+// GetOpenGroups returns the groups still being set up on the given events that the user is not a member of
+func GetOpenGroups(campusName string, userId int, eventIds []int, client *ApiInterface.Client) ([]Group, error) {
+	return getGroups("queries/get_open_groups.graphql", map[string]interface{}{"campusName": campusName, "userID": userId, "eventIds": eventIds}, client)
+}
+
+func GetGroup(groupId int, client *ApiInterface.Client) (Group, error) {
+	groups, err := getGroups("queries/get_group.graphql", map[string]interface{}{"groupId": groupId}, client)
+	if err != nil {
+		return Group{}, err
+	}
+	if len(groups) == 0 {
+		return Group{}, ErrGroupNotFound
+	}
+	return groups[0], nil
+}
+
+// CreateGroup creates a group whose members, captain included, have all accepted the invitation
+func CreateGroup(campusName string, eventId int, objectId int, path string, captainId int, memberIds []int, client *ApiInterface.Client) (int, error) {
+	query, err := loadQueryFromFile("queries/insert_group.graphql")
+	if err != nil {
+		return 0, err
+	}
+	members := []map[string]interface{}{{"userId": captainId, "accepted": true}}
+	for _, memberId := range memberIds {
+		if memberId != captainId {
+			members = append(members, map[string]interface{}{"userId": memberId, "accepted": true})
+		}
+	}
+	data, err := client.Run(query, map[string]interface{}{"object": map[string]interface{}{
+		"campus":    campusName,
+		"eventId":   eventId,
+		"objectId":  objectId,
+		"path":      path,
+		"captainId": captainId,
+		"status":    "setup",
+		"members":   map[string]interface{}{"data": members},
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return int(data["insert_group_one"].(map[string]interface{})["id"].(float64)), nil
+}
+
+// MergeGroups moves the members of the source group into the target group and deletes the source group,
+// users that are members of both groups are only kept in the target group
+func MergeGroups(target Group, source Group, client *ApiInterface.Client) error {
+	query, err := loadQueryFromFile("queries/merge_groups.graphql")
+	if err != nil {
+		return err
+	}
+	inTarget := make(map[int]bool)
+	for _, member := range target.Members {
+		inTarget[member.UserId] = true
+	}
+	duplicates := []int{}
+	for _, member := range source.Members {
+		if inTarget[member.UserId] {
+			duplicates = append(duplicates, member.UserId)
+		}
+	}
+	_, err = client.Run(query, map[string]interface{}{"targetId": target.Id, "sourceId": source.Id, "duplicateUserIds": duplicates})
+	return err
+}
+
+// DeleteGroup removes all the members of the group and the group itself
+func DeleteGroup(groupId int, client *ApiInterface.Client) error {
+	query, err := loadQueryFromFile("queries/delete_group.graphql")
+	if err != nil {
+		return err
+	}
+	_, err = client.Run(query, map[string]interface{}{"groupId": groupId})
+	return err
+}
+
+// eventIdFilter reads the optional eventId parameter, 0 means all events
+func eventIdFilter(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("eventId")
+	if v == "" {
+		return 0, nil
+	}
+	eventId, err := strconv.Atoi(v)
+	if err != nil || eventId <= 0 {
+		return 0, errors.New("invalid eventId parameter")
+	}
+	return eventId, nil
+}
+
+// userEventIds returns the ids of the courses of the user, restricted to eventId when it is not 0
+func userEventIds(userId int, eventId int, client *ApiInterface.Client) ([]int, error) {
+	courses, err := GetUserCourses(platformConfig.CampusName, userId, client)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int{}
+	for _, id := range courseIds(courses) {
+		if eventId == 0 || id == eventId {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// userGroupsHandler lists the groups of the user on their courses
+func userGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	eventId, err := eventIdFilter(r)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	eventIds, err := userEventIds(contextUserId(r), eventId, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, upstreamErrorStatus(err))
+		return
+	}
+	groups := []Group{}
+	if len(eventIds) > 0 {
+		groups, err = GetUserGroups(platformConfig.CampusName, contextUserId(r), eventIds, apiClient(r))
+		if err != nil {
+			returnJsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	returnJson(w, r, groups)
+}
+
+// openGroupsHandler lists the groups the user could join on their courses
+func openGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	eventId, err := eventIdFilter(r)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	eventIds, err := userEventIds(contextUserId(r), eventId, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, upstreamErrorStatus(err))
+		return
+	}
+	groups := []Group{}
+	if len(eventIds) > 0 {
+		groups, err = GetOpenGroups(platformConfig.CampusName, contextUserId(r), eventIds, apiClient(r))
+		if err != nil {
+			returnJsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	returnJson(w, r, groups)
+}
+
+// pathGroupId reads the {id} wildcard of the route as a group id
+func pathGroupId(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid group id")
+	}
+	return id, nil
+}
+
+type CreateGroupRequest struct {
+	EventId   int    `json:"eventId" validate:"required,min=1"`
+	ObjectId  int    `json:"objectId" validate:"required,min=1"`
+	Path      string `json:"path" validate:"required,max=255"`
+	CaptainId int    `json:"captainId" validate:"required,min=1"`
+	MemberIds []int  `json:"memberIds" validate:"max=100"`
+}
+
+// MergeGroupRequest names the group whose members join the group of the url
+type MergeGroupRequest struct {
+	GroupId int `json:"groupId" validate:"required,min=1"`
+}
+
+func createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		returnJsonError(w, r, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	var body CreateGroupRequest
+	if !decodeJsonBody(w, r, &body) {
+		return
+	}
+	groupId, err := CreateGroup(platformConfig.CampusName, body.EventId, body.ObjectId, body.Path, body.CaptainId, body.MemberIds, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	group, err := GetGroup(groupId, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	returnJsonStatus(w, r, http.StatusCreated, group)
+}
+
+// mergeGroupHandler merges the group given in the body into the group of the url
+func mergeGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		returnJsonError(w, r, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	targetId, err := pathGroupId(r)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	var body MergeGroupRequest
+	if !decodeJsonBody(w, r, &body) {
+		return
+	}
+	if body.GroupId == targetId {
+		returnJsonError(w, r, &ValidationError{Fields: []FieldError{{Field: "groupId", Message: "must be the id of another group"}}}, http.StatusBadRequest)
+		return
+	}
+	target, err := GetGroup(targetId, apiClient(r))
+	if err == nil {
+		var source Group
+		source, err = GetGroup(body.GroupId, apiClient(r))
+		if err == nil {
+			if source.EventId != target.EventId || source.Path != target.Path {
+				returnJsonError(w, r, errors.New("only groups of the same project can be merged"), http.StatusConflict)
+				return
+			}
+			err = MergeGroups(target, source, apiClient(r))
+		}
+	}
+	if errors.Is(err, ErrGroupNotFound) {
+		returnJsonError(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	group, err := GetGroup(targetId, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	returnJson(w, r, group)
+}
+
+func disbandGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		returnJsonError(w, r, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	groupId, err := pathGroupId(r)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	_, err = GetGroup(groupId, apiClient(r))
+	if errors.Is(err, ErrGroupNotFound) {
+		returnJsonError(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		err = DeleteGroup(groupId, apiClient(r))
+	}
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	returnJson(w, r, Message{Message: "Group disbanded"})
+}
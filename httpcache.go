@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Campus data is the same for everyone and may be stored by shared caches for a short while
+	publicCacheControl = "public, max-age=60"
+	// User data may only be stored by the browser, which must revalidate it on every use
+	privateCacheControl = "private, no-cache"
+	// Admin data and mutations are never stored
+	noStoreCacheControl = "no-store"
+)
+
+// computeETag returns a strong entity tag derived from the response body
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches implements the weak comparison used by If-None-Match
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified evaluates the conditional headers of a GET or HEAD request, If-None-Match takes precedence
+// over If-Modified-Since as required by RFC 9110
+func notModified(r *http.Request, etag string, lastModified string) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagMatches(header, etag)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified == "" {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// setLastModified sets the Last-Modified header, a zero time means the date is unknown
+func setLastModified(w http.ResponseWriter, t time.Time) {
+	if !t.IsZero() {
+		w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+}
+
+// withCacheControl sets the Cache-Control header of every response of the handler
+func withCacheControl(value string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", value)
+		next(w, r)
+	}
+}
+
+func publicCache(next http.HandlerFunc) http.HandlerFunc {
+	return withCacheControl(publicCacheControl, next)
+}
+
+func privateCache(next http.HandlerFunc) http.HandlerFunc {
+	return withCacheControl(privateCacheControl, next)
+}
+
+func noStore(next http.HandlerFunc) http.HandlerFunc {
+	return withCacheControl(noStoreCacheControl, next)
+}
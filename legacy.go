@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// LegacyError is the error body of the unprefixed routes, as they answered before the API was versioned
+type LegacyError struct {
+	Error string `json:"error"`
+}
+
+// legacyHandlers replace the handlers of the routes whose response changed in /v1, so that their
+// unprefixed alias keeps the former shape. The other aliases run the /v1 handler.
+var legacyHandlers = map[string]http.HandlerFunc{
+	"/{$}":                   legacyWelcomeHandler,
+	"/campus/courses":        publicCache(legacyCampusCoursesHandler),
+	"/user/availableCourses": privateCache(legacyAvailableCoursesHandler),
+}
+
+func legacyWelcomeHandler(w http.ResponseWriter, r *http.Request) {
+	returnJson(w, r, "Welcome to the Ytrack Manager API")
+}
+
+// legacyCampusCoursesHandler returns every course of the campus, without pagination
+func legacyCampusCoursesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	courses, err := GetCachedCampusCourses(platformConfig.CampusName, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, upstreamErrorStatus(err))
+		return
+	}
+	returnJson(w, r, courses)
+}
+
+// legacyAvailableCoursesHandler only returns the courses the user is not registered to
+func legacyAvailableCoursesHandler(w http.ResponseWriter, r *http.Request) {
+	views, ok := userCourseViews(w, r)
+	if !ok {
+		return
+	}
+	returnJson(w, r, views.Available)
+}
+
+// legacyRecorder buffers the response of a handler so that legacyResponse can rewrite it
+type legacyRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *legacyRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *legacyRecorder) WriteHeader(status int) {
+	rec.status = status
+}
+
+func (rec *legacyRecorder) Write(data []byte) (int, error) {
+	return rec.body.Write(data)
+}
+
+// legacyResponse converts the responses of a /v1 handler to the format of the unprefixed routes: the data
+// is sent without its envelope and the problem documents become {"error": detail} bodies
+func legacyResponse(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &legacyRecorder{header: w.Header(), status: http.StatusOK}
+		next(rec, r)
+		body := rec.body.Bytes()
+		mediaType, _, _ := mime.ParseMediaType(rec.header.Get("Content-Type"))
+		switch mediaType {
+		case "application/problem+json":
+			var problem Problem
+			if err := json.Unmarshal(body, &problem); err == nil {
+				body, _ = json.Marshal(LegacyError{Error: problem.Detail})
+				rec.header.Set("Content-Type", "application/json")
+			}
+		case "application/json":
+			var envelope struct {
+				Data json.RawMessage `json:"data"`
+			}
+			if rec.status == http.StatusNotModified || json.Unmarshal(body, &envelope) != nil || envelope.Data == nil {
+				break
+			}
+			body = envelope.Data
+			// the entity tag of the envelope does not match the body that is sent
+			etag := computeETag(body)
+			rec.header.Set("ETag", etag)
+			if rec.status == http.StatusOK && notModified(r, etag, rec.header.Get("Last-Modified")) {
+				rec.status = http.StatusNotModified
+				body = nil
+			}
+		}
+		if len(body) > 0 {
+			rec.header.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		w.WriteHeader(rec.status)
+		if _, err := w.Write(body); err != nil {
+			slog.WarnContext(r.Context(), "response write failed", "error", err)
+		}
+	}
+}
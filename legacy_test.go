@@ -0,0 +1,64 @@
+package main
+
+import (
+	"Ytrack-Manager/tools"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLegacyAliasesKeepTheFormerResponses(t *testing.T) {
+	legacy, err := newLegacyAliases(tools.LegacyRoutesConfig{Enabled: true, DeprecatedAt: "2026-01-01", SunsetAt: "2027-01-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := newRouter()
+	registerRoutes(rt, legacy)
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"welcome alias", "GET", "/", http.StatusOK, "application/json", `"Welcome to the Ytrack Manager API"`},
+		{"welcome", "GET", "/v1/", http.StatusOK, "application/json", `{"data":{"message":"Welcome to the Ytrack Manager API"}}`},
+		{"error alias", "POST", "/campus/courses/register", http.StatusBadRequest, "application/json", `{"error":"x-token header is missing"}`},
+		{"error", "POST", "/v1/campus/courses/register", http.StatusBadRequest, "application/problem+json", `"detail":"x-token header is missing"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rt.mux.ServeHTTP(w, httptest.NewRequest(test.method, test.path, strings.NewReader(`{"courseId": 1}`)))
+			if w.Code != test.status || w.Header().Get("Content-Type") != test.contentType {
+				t.Errorf("got status %d and %s, expected %d and %s", w.Code, w.Header().Get("Content-Type"), test.status, test.contentType)
+			}
+			if !strings.Contains(w.Body.String(), test.body) {
+				t.Errorf("got %s, expected %s", w.Body.String(), test.body)
+			}
+			if deprecated := w.Header().Get("Deprecation") != ""; deprecated != !strings.HasPrefix(test.path, "/v1/") {
+				t.Errorf("got Deprecation header %q", w.Header().Get("Deprecation"))
+			}
+		})
+	}
+}
+
+func TestLegacyResponseRecomputesTheETag(t *testing.T) {
+	handler := legacyResponse(func(w http.ResponseWriter, r *http.Request) {
+		returnJson(w, r, CampusSummary{Id: 1, Name: "campus", Type: "campus"})
+	})
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/campus", nil))
+	if expected := `{"id":1,"name":"campus","type":"campus"}`; w.Body.String() != expected {
+		t.Fatalf("got %s, expected %s", w.Body.String(), expected)
+	}
+	r := httptest.NewRequest("GET", "/campus", nil)
+	r.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("got %d %q, expected 304 without body", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"Ytrack-Manager/tools"
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// Attributes whose value is a secret whatever it looks like
+var secretKeys = map[string]bool{"token": true, "x-token": true, "authorization": true, "jwt": true, "x-jwt-token": true}
+
+var (
+	// a JSON Web Token, as found in the x-token header and the Hasura authorization
+	jwtPattern = regexp.MustCompile(`eyJ[\w-]*\.[\w-]*\.[\w-]*`)
+	// the calendar feed token of a subscription url
+	tokenParamPattern = regexp.MustCompile(`([?&]token=)[^&\s"]+`)
+)
+
+// setupLogger makes slog, and the log package through it, write JSON logs, or text logs for a local start
+func setupLogger(config tools.LogConfig, localStart bool) error {
+	var level slog.Level
+	if config.Level != "" {
+		if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+			return errors.New("invalid log level " + config.Level + ", expected debug, info, warn or error")
+		}
+	}
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	switch config.Format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, options)
+	case "":
+		if localStart {
+			handler = slog.NewTextHandler(os.Stderr, options)
+		} else {
+			handler = slog.NewJSONHandler(os.Stderr, options)
+		}
+	default:
+		return errors.New("invalid log format " + config.Format + ", expected json or text")
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
+
+// redactAttr hides the tokens before they are written, the secret attributes are dropped entirely and
+// tokens are removed from any message or string value
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if secretKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+	}
+	return a
+}
+
+func redactString(s string) string {
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	return tokenParamPattern.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// contextHandler adds the request id and the trace of the context to every record logged with it
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := ApiInterface.RequestId(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// statusRecorder remembers the status and the size of the response for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// The key of the *accessLogState of the request in its context
+const accessLogKey contextKey = "accessLog"
+
+// accessLogState collects what the handlers learn about the request for its access log
+type accessLogState struct {
+	userId int
+}
+
+// logUserId adds the id of the user to the access log of the request, it must only be called once the
+// token of the user has been verified
+func logUserId(r *http.Request, userId int) {
+	if state, ok := r.Context().Value(accessLogKey).(*accessLogState); ok {
+		state.userId = userId
+	}
+}
+
+// accessLog gives the request its id, echoed in the X-Request-ID response header and sent along the
+// calls to Ytrack, and logs the request once answered, with the id of the user when their token was
+// verified. The route is the registered pattern so that requests to the same handler are grouped, the
+// query string is left out as it may hold a feed token.
+func accessLog(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := requestId(r)
+		w.Header().Set("X-Request-ID", id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.request.id", id))
+		state := &accessLogState{}
+		r = r.WithContext(context.WithValue(ApiInterface.WithRequestId(r.Context(), id), accessLogKey, state))
+		recorder := &statusRecorder{ResponseWriter: w}
+		next(recorder, r)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", recorder.bytes),
+			slog.String("client_ip", clientIp(r)),
+		}
+		if state.userId != 0 {
+			attrs = append(attrs, slog.Int("user_id", state.userId))
+		}
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	}
+}
@@ -3,84 +3,64 @@ package main
 import (
 	"Ytrack-Manager/ApiInterface"
 	"Ytrack-Manager/tools"
-	"encoding/json"
+	"context"
 	"errors"
-	"fmt"
-	"io"
+	"flag"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
 var client *ApiInterface.Client
+var platformConfig tools.Config
+var auditLog *AuditLog
+var feedTokens *FeedTokenStore
 
-type Campus struct {
-	Id       int                    `json:"id"`
-	Name     string                 `json:"name"`
-	Type     string                 `json:"type"`
-	Attrs    map[string]interface{} `json:"attrs"`
-	Children map[string]CampusChild `json:"children"`
+type CampusSummary struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
 }
 
-type CampusChild struct {
-	Id    int    `json:"id"`
-	Name  string `json:"name"`
-	Index int    `json:"index"`
+type Course struct {
+	Id      int        `json:"id"`
+	Name    string     `json:"name"`
+	Campus  string     `json:"campus"`
+	StartAt *time.Time `json:"startAt,omitempty"`
+	EndAt   *time.Time `json:"endAt,omitempty"`
 }
 
-func GetCampus(campusName string) (Campus, error) {
-	var campus Campus
-
-	resp, err := http.Get("https://ytrack.learn.ynov.com/api/object/" + campusName)
-	if err != nil {
-		return Campus{}, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return Campus{}, err
+// parseTimestamp reads a nullable timestamp returned by Hasura
+func parseTimestamp(value interface{}) *time.Time {
+	str, ok := value.(string)
+	if !ok {
+		return nil
 	}
-	temp := make(map[string]interface{})
-
-	err = json.Unmarshal(body, &temp)
+	t, err := time.Parse(time.RFC3339, str)
 	if err != nil {
-		return Campus{}, err
+		return nil
 	}
-	// catch the panic that occurs when the campusName is not found
-	defer func() {
-		if r := recover(); r != nil {
-			log.Fatal("The campus name was not found, check the platform configuration file")
-		}
-	}()
-
-	campus.Id = int(temp["id"].(float64))
-	campus.Name = temp["name"].(string)
-	campus.Type = temp["type"].(string)
-	campus.Attrs = temp["attrs"].(map[string]interface{})
-	campus.Children = make(map[string]CampusChild)
-
-	if children, ok := temp["children"].(map[string]interface{}); ok {
-		for key := range children {
-			child := children[key].(map[string]interface{})
-			campus.Children[key] = CampusChild{
-				Id:    int(child["id"].(float64)),
-				Name:  key,
-				Index: int(child["index"].(float64)),
-			}
-		}
-	}
-
-	return campus, nil
+	return &t
 }
 
-type Course struct {
-	Id     int    `json:"id"`
-	Name   string `json:"name"`
-	Campus string `json:"campus"`
+// parseCourse builds a course from an event returned by the course queries
+func parseCourse(course map[string]interface{}) Course {
+	return Course{
+		Id:      int(course["id"].(float64)),
+		Name:    course["object"].(map[string]interface{})["name"].(string),
+		Campus:  course["object"].(map[string]interface{})["campus"].(string),
+		StartAt: parseTimestamp(course["startAt"]),
+		EndAt:   parseTimestamp(course["endAt"]),
+	}
 }
 
 // Function to read query from a file
@@ -101,14 +81,10 @@ func GetCampusCourses(campusName string, client *ApiInterface.Client) ([]Course,
 	if err != nil {
 		return nil, err
 	}
-	var courses []Course
+	courses := []Course{}
 	for _, v := range data["event"].([]interface{}) {
 		course := v.(map[string]interface{})
-		courses = append(courses, Course{
-			Id:     int(course["id"].(float64)),
-			Name:   course["object"].(map[string]interface{})["name"].(string),
-			Campus: course["object"].(map[string]interface{})["campus"].(string),
-		})
+		courses = append(courses, parseCourse(course))
 	}
 
 	return courses, nil
@@ -123,19 +99,119 @@ func GetUserCourses(campusName string, userId int, client *ApiInterface.Client)
 	if err != nil {
 		return nil, err
 	}
-	var courses []Course
-	for _, v := range data["user"].([]interface{})[0].(map[string]interface{})["events"].([]interface{}) {
+	users := data["user"].([]interface{})
+	if len(users) == 0 {
+		return nil, ErrUserNotFound
+	}
+	courses := []Course{}
+	for _, v := range users[0].(map[string]interface{})["events"].([]interface{}) {
 		course := v.(map[string]interface{})["event"].(map[string]interface{})
-		courses = append(courses, Course{
-			Id:     int(course["id"].(float64)),
-			Name:   course["object"].(map[string]interface{})["name"].(string),
-			Campus: course["object"].(map[string]interface{})["campus"].(string),
-		})
+		courses = append(courses, parseCourse(course))
 	}
 
 	return courses, nil
 }
 
+// CourseViews splits the campus courses between the ones the user is registered to and the others
+type CourseViews struct {
+	Registered []Course `json:"registered"`
+	Available  []Course `json:"available"`
+}
+
+// GetCourseViews fetches the campus courses flagged with the registration of the user in a single query.
+// When that query fails it falls back to filtering the cached campus courses with the user courses.
+func GetCourseViews(campusName string, userId int, client *ApiInterface.Client) (CourseViews, error) {
+	views, err := queryCourseViews(campusName, userId, client)
+	if err == nil || errors.Is(err, ErrUserNotFound) {
+		return views, err
+	}
+	slog.Warn("course views query failed, falling back to separate queries", "error", err)
+	courses, err := GetCachedCampusCourses(campusName, client)
+	if err != nil {
+		return CourseViews{}, err
+	}
+	userCourses, err := GetUserCourses(campusName, userId, client)
+	if err != nil {
+		return CourseViews{}, err
+	}
+	return splitCourses(courses, userCourses), nil
+}
+
+func queryCourseViews(campusName string, userId int, client *ApiInterface.Client) (CourseViews, error) {
+	query, err := loadQueryFromFile("queries/queryCourseViews.graphql")
+	if err != nil {
+		return CourseViews{}, err
+	}
+	data, err := client.Run(query, map[string]interface{}{"campusName": campusName, "userID": userId})
+	if err != nil {
+		return CourseViews{}, err
+	}
+	return parseCourseViews(data)
+}
+
+// parseCourseViews splits the events of the course views query, an unknown user is reported as
+// ErrUserNotFound like GetUserCourses does on the fallback path
+func parseCourseViews(data map[string]interface{}) (CourseViews, error) {
+	users, ok := data["user"].([]interface{})
+	if !ok {
+		return CourseViews{}, errors.New("unexpected course views response")
+	}
+	if len(users) == 0 {
+		return CourseViews{}, ErrUserNotFound
+	}
+	events, ok := data["event"].([]interface{})
+	if !ok {
+		return CourseViews{}, errors.New("unexpected course views response")
+	}
+	views := CourseViews{Registered: []Course{}, Available: []Course{}}
+	for _, v := range events {
+		event := v.(map[string]interface{})
+		registrations, ok := event["usersRelation"].([]interface{})
+		if !ok {
+			return CourseViews{}, errors.New("unexpected course views response")
+		}
+		if len(registrations) > 0 {
+			views.Registered = append(views.Registered, parseCourse(event))
+		} else {
+			views.Available = append(views.Available, parseCourse(event))
+		}
+	}
+	return views, nil
+}
+
+// splitCourses keeps the campus courses missing from the user courses as available
+func splitCourses(courses []Course, userCourses []Course) CourseViews {
+	registered := make(map[int]bool, len(userCourses))
+	for _, course := range userCourses {
+		registered[course.Id] = true
+	}
+	views := CourseViews{Registered: append([]Course{}, userCourses...), Available: []Course{}}
+	for _, course := range courses {
+		if !registered[course.Id] {
+			views.Available = append(views.Available, course)
+		}
+	}
+	return views
+}
+
+type UserNames struct {
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+type UserRoles struct {
+	Roles []string `json:"roles"`
+}
+
+type UserId struct {
+	Id int `json:"id"`
+}
+
+// CourseRegistrationRequest is the body of the requests a user sends to join or leave a course
+type CourseRegistrationRequest struct {
+	CourseId int `json:"courseId" validate:"required,min=1"`
+}
+
 func GetUserNames(userId int, client *ApiInterface.Client) (string, string, error) {
 	query, err := loadQueryFromFile("queries/get_user_name.graphql")
 	if err != nil {
@@ -148,15 +224,73 @@ func GetUserNames(userId int, client *ApiInterface.Client) (string, string, erro
 	return data["user"].([]interface{})[0].(map[string]interface{})["firstName"].(string), data["user"].([]interface{})[0].(map[string]interface{})["lastName"].(string), nil
 }
 
+var ErrUserNotFound = errors.New("user not found")
+
+type UserProfile struct {
+	Id               int      `json:"id"`
+	Login            string   `json:"login"`
+	FirstName        string   `json:"firstName"`
+	LastName         string   `json:"lastName"`
+	Email            string   `json:"email"`
+	Campus           string   `json:"campus"`
+	Roles            []string `json:"roles"`
+	AuditRatio       float64  `json:"auditRatio"`
+	TotalXp          int      `json:"totalXp"`
+	RegisteredEvents int      `json:"registeredEvents"`
+}
+
+// GetUserProfile fetches the whole profile in a single query, the roles are not stored in the database and are left empty
+func GetUserProfile(campusName string, userId int, client *ApiInterface.Client) (UserProfile, error) {
+	query, err := loadQueryFromFile("queries/get_user_profile.graphql")
+	if err != nil {
+		return UserProfile{}, err
+	}
+	data, err := client.Run(query, map[string]interface{}{"campusName": campusName, "userID": userId})
+	if err != nil {
+		return UserProfile{}, err
+	}
+	users := data["user"].([]interface{})
+	if len(users) == 0 {
+		return UserProfile{}, ErrUserNotFound
+	}
+	user := users[0].(map[string]interface{})
+	profile := UserProfile{
+		Id:    int(user["id"].(float64)),
+		Login: user["login"].(string),
+		Roles: []string{},
+	}
+	// most of the fields are nullable in the database
+	profile.FirstName, _ = user["firstName"].(string)
+	profile.LastName, _ = user["lastName"].(string)
+	profile.Email, _ = user["email"].(string)
+	profile.Campus, _ = user["campus"].(string)
+	profile.AuditRatio, _ = user["auditRatio"].(float64)
+	xp, _ := user["xp"].(map[string]interface{})["aggregate"].(map[string]interface{})["sum"].(map[string]interface{})["amount"].(float64)
+	profile.TotalXp = int(xp)
+	profile.RegisteredEvents = int(user["events_aggregate"].(map[string]interface{})["aggregate"].(map[string]interface{})["count"].(float64))
+	return profile, nil
+}
+
 func RegisterUserToCourse(userId int, courseId int, client *ApiInterface.Client) error {
+	return RegisterUsersToCourse([]int{userId}, courseId, client)
+}
+
+// RegisterUsersToCourse registers all the users in a single mutation, either all of them are registered or none
+func RegisterUsersToCourse(userIds []int, courseId int, client *ApiInterface.Client) error {
 	query, err := loadQueryFromFile("queries/insert_event_user.graphql")
 	if err != nil {
 		return err
 	}
-	_, err = client.Run(query, map[string]interface{}{"objects": []map[string]interface{}{{"eventId": courseId, "userId": userId}}})
+	objects := make([]map[string]interface{}, 0, len(userIds))
+	for _, userId := range userIds {
+		objects = append(objects, map[string]interface{}{"eventId": courseId, "userId": userId})
+	}
+	_, err = client.Run(query, map[string]interface{}{"objects": objects})
 	if err != nil {
 		return err
 	}
+	countRegistrations(courseId, AuditActionRegister, len(userIds))
+	invalidateCourseCaches()
 	return nil
 }
 
@@ -169,379 +303,727 @@ func RemoveUserFromCourse(userId int, courseId int, client *ApiInterface.Client)
 	if err != nil {
 		return err
 	}
+	countRegistrations(courseId, AuditActionUnregister, 1)
+	invalidateCourseCaches()
 	return nil
 }
 
-func ExtractId(token string) (int, error) {
+func IsUserRegisteredToCourse(userId int, courseId int, client *ApiInterface.Client) (bool, error) {
+	query, err := loadQueryFromFile("queries/get_event_user.graphql")
+	if err != nil {
+		return false, err
+	}
+	data, err := client.Run(query, map[string]interface{}{"userId": userId, "eventId": courseId})
+	if err != nil {
+		return false, err
+	}
+	return len(data["event_user"].([]interface{})) > 0, nil
+}
+
+// GetRegisteredUserIds returns which of the given users are registered to the course
+func GetRegisteredUserIds(userIds []int, courseId int, client *ApiInterface.Client) (map[int]bool, error) {
+	query, err := loadQueryFromFile("queries/get_event_users.graphql")
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.Run(query, map[string]interface{}{"eventId": courseId, "userIds": userIds})
+	if err != nil {
+		return nil, err
+	}
+	registered := make(map[int]bool)
+	for _, v := range data["event_user"].([]interface{}) {
+		registered[int(v.(map[string]interface{})["userId"].(float64))] = true
+	}
+	return registered, nil
+}
+
+type User struct {
+	Id    int    `json:"id"`
+	Login string `json:"login"`
+}
+
+// GetUsers looks up the users matching any of the ids or logins
+func GetUsers(ids []int, logins []string, client *ApiInterface.Client) ([]User, error) {
+	query, err := loadQueryFromFile("queries/get_users.graphql")
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.Run(query, map[string]interface{}{"ids": ids, "logins": logins})
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	for _, v := range data["user"].([]interface{}) {
+		user := v.(map[string]interface{})
+		users = append(users, User{
+			Id:    int(user["id"].(float64)),
+			Login: user["login"].(string),
+		})
+	}
+	return users, nil
+}
+
+type Participant struct {
+	Id           int    `json:"id"`
+	Login        string `json:"login"`
+	FirstName    string `json:"firstName"`
+	LastName     string `json:"lastName"`
+	RegisteredAt string `json:"registeredAt"`
+}
+
+// GetCourseParticipants returns a page of the users registered to the course along with the total number of users
+func GetCourseParticipants(courseId int, limit int, offset int, client *ApiInterface.Client) ([]Participant, int, error) {
+	query, err := loadQueryFromFile("queries/queryEventParticipants.graphql")
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := client.Run(query, map[string]interface{}{"eventId": courseId, "limit": limit, "offset": offset})
+	if err != nil {
+		return nil, 0, err
+	}
+	participants := []Participant{}
+	for _, v := range data["event_user"].([]interface{}) {
+		registration := v.(map[string]interface{})
+		user := registration["user"].(map[string]interface{})
+		participant := Participant{
+			Id:    int(user["id"].(float64)),
+			Login: user["login"].(string),
+		}
+		// names and dates are nullable in the database
+		participant.FirstName, _ = user["firstName"].(string)
+		participant.LastName, _ = user["lastName"].(string)
+		participant.RegisteredAt, _ = registration["createdAt"].(string)
+		participants = append(participants, participant)
+	}
+	total := int(data["event_user_aggregate"].(map[string]interface{})["aggregate"].(map[string]interface{})["count"].(float64))
+	return participants, total, nil
+}
+
+// hasuraClaims returns the Hasura claims of the token. The signature is not checked here, see verifyToken.
+func hasuraClaims(token string) (map[string]interface{}, error) {
 	payload, err := ApiInterface.Decode(token)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := payload["https://hasura.io/jwt/claims"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("the token has no hasura claims")
+	}
+	return claims, nil
+}
+
+func ExtractId(token string) (int, error) {
+	claims, err := hasuraClaims(token)
 	if err != nil {
 		return 0, err
 	}
-	id, err := strconv.Atoi(payload["https://hasura.io/jwt/claims"].(map[string]interface{})["x-hasura-user-id"].(string))
+	value, ok := claims["x-hasura-user-id"].(string)
+	if !ok {
+		return 0, errors.New("the token has no user id")
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return 0, errors.New("the token has an invalid user id")
+	}
 	return id, nil
 }
 
 func ExtractRoles(token string) ([]string, error) {
-	payload, err := ApiInterface.Decode(token)
+	claims, err := hasuraClaims(token)
 	if err != nil {
 		return nil, err
 	}
-	roles := payload["https://hasura.io/jwt/claims"].(map[string]interface{})["x-hasura-allowed-roles"].([]interface{})
-	var rolesString []string
+	roles, ok := claims["x-hasura-allowed-roles"].([]interface{})
+	if !ok {
+		return nil, errors.New("the token has no roles")
+	}
+	rolesString := []string{}
 	for _, role := range roles {
-		rolesString = append(rolesString, role.(string))
+		r, ok := role.(string)
+		if !ok {
+			return nil, errors.New("the token has an invalid role")
+		}
+		rolesString = append(rolesString, r)
 	}
 	return rolesString, nil
 }
 
-func returnJsonError(w http.ResponseWriter, err error, status int) {
-	log.Println(err)
-	w.Header().Set("Content-Type", "application/json")
-	jsonData, err := json.Marshal(struct {
-		Error string `json:"error"`
-	}{
-		Error: err.Error(),
+// upstreamErrorStatus returns the status matching an error returned while fetching data from Ytrack
+func upstreamErrorStatus(err error) int {
+	var statusErr *ApiInterface.StatusError
+	switch {
+	case errors.Is(err, ApiInterface.ErrCampusNotFound), errors.Is(err, ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &statusErr):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+func welcomeHandler(w http.ResponseWriter, r *http.Request) {
+	returnJson(w, r, Message{Message: "Welcome to the Ytrack Manager API"})
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	returnJsonError(w, r, errors.New("no route matches "+r.URL.Path), http.StatusNotFound)
+}
+
+func campusHandler(w http.ResponseWriter, r *http.Request) {
+	// print the campus information in json format
+	campus, err := GetCachedCampus(platformConfig.CampusName, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, upstreamErrorStatus(err))
+		return
+	}
+	returnJson(w, r, CampusSummary{
+		Id:   campus.Id,
+		Name: campus.Name,
+		Type: campus.Type,
 	})
+}
+
+func userHandler(w http.ResponseWriter, r *http.Request) {
+	profile, err := GetUserProfile(platformConfig.CampusName, contextUserId(r), apiClient(r))
+	if errors.Is(err, ErrUserNotFound) {
+		returnJsonError(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	// the roles come from the token, verified by requireUser, rather than from the database
+	profile.Roles, err = ExtractRoles(r.Header.Get("x-token"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		returnJsonError(w, r, err, http.StatusBadRequest)
 		return
 	}
-	http.Error(w, string(jsonData), status)
+	returnJson(w, r, profile)
 }
 
-func returnJson(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	jsonData, err := json.Marshal(data)
+func userNameHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "x-token")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// read the x-token header
+	token := r.Header.Get("x-token")
+	if token == "" {
+		returnJsonError(w, r, errors.New("x-token header is missing"), http.StatusBadRequest)
+		return
+	}
+	// verify the token before trusting the user id it carries
+	identity, ok := verifiedIdentity(w, r, token)
+	if !ok {
+		return
+	}
+	id := identity.Id
+	// get the user name
+	firstName, lastName, err := GetUserNames(id, apiClient(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	returnJson(w, r, UserNames{
+		FirstName: firstName,
+		LastName:  lastName,
+	})
+}
+
+func userRolesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "x-token")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// read the x-token header
+	token := r.Header.Get("x-token")
+	if token == "" {
+		returnJsonError(w, r, errors.New("x-token header is missing"), http.StatusBadRequest)
+		return
+	}
+	// verify the token before trusting the roles it carries
+	identity, ok := verifiedIdentity(w, r, token)
+	if !ok {
+		return
 	}
-	_, err = w.Write(jsonData)
+	returnJson(w, r, UserRoles{Roles: identity.Roles})
+}
+
+func extractIdHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "x-token")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// read the x-token header
+	token := r.Header.Get("x-token")
+	if token == "" {
+		returnJsonError(w, r, errors.New("x-token header is missing"), http.StatusBadRequest)
+		return
+	}
+	// verify the token before trusting the user id it carries
+	identity, ok := verifiedIdentity(w, r, token)
+	if !ok {
+		return
+	}
+	id := identity.Id
+	returnJson(w, r, UserId{Id: id})
+}
+
+func userCoursesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "x-token")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// read the x-token header
+	token := r.Header.Get("x-token")
+	if token == "" {
+		returnJsonError(w, r, errors.New("x-token header is missing"), http.StatusBadRequest)
+		return
+	}
+	// verify the token before trusting the user id it carries
+	identity, ok := verifiedIdentity(w, r, token)
+	if !ok {
+		return
+	}
+	id := identity.Id
+	// get the user courses
+	courses, err := GetUserCourses(platformConfig.CampusName, id, apiClient(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		returnJsonError(w, r, err, upstreamErrorStatus(err))
+		return
 	}
+	returnJson(w, r, courses)
 }
 
-func main() {
+func availableCoursesHandler(w http.ResponseWriter, r *http.Request) {
+	views, ok := userCourseViews(w, r)
+	if !ok {
+		return
+	}
+	returnJson(w, r, views)
+}
 
-	var errr error
-	var platformConfig tools.Config
+// userCourseViews answers the preflight requests and returns the course views of the user of the x-token.
+// When it returns false the response has already been written.
+func userCourseViews(w http.ResponseWriter, r *http.Request) (CourseViews, bool) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "x-token")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return CourseViews{}, false
+	}
+	// read the x-token header
+	token := r.Header.Get("x-token")
+	if token == "" {
+		returnJsonError(w, r, errors.New("x-token header is missing"), http.StatusBadRequest)
+		return CourseViews{}, false
+	}
+	// verify the token before trusting the user id it carries
+	identity, ok := verifiedIdentity(w, r, token)
+	if !ok {
+		return CourseViews{}, false
+	}
+	// get the campus courses split between the registered and the available ones
+	views, err := GetCourseViews(platformConfig.CampusName, identity.Id, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, upstreamErrorStatus(err))
+		return CourseViews{}, false
+	}
+	return views, true
+}
 
-	platformConfig, errr = tools.LoadConfigFromFile("config.json")
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-token")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// read the x-token header
+	token := r.Header.Get("x-token")
+	if token == "" {
+		returnJsonError(w, r, errors.New("x-token header is missing"), http.StatusBadRequest)
+		return
+	}
+	// verify the token before trusting the user id it carries
+	identity, ok := verifiedIdentity(w, r, token)
+	if !ok {
+		return
+	}
+	userId := identity.Id
+	// get the course userId from the request body
+	var body CourseRegistrationRequest
+	if !decodeJsonBody(w, r, &body) {
+		return
+	}
+	err := RegisterUserToCourse(userId, body.CourseId, apiClient(r))
+	if auditErr := auditLog.Record(newAuditEntry(r, userId, userId, body.CourseId, AuditActionRegister, err)); auditErr != nil {
+		slog.ErrorContext(r.Context(), "audit log write failed", "error", auditErr)
+	}
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	returnJson(w, r, Message{Message: "User registered to the course"})
+}
 
-	client, errr = ApiInterface.NewClient(platformConfig.Domain)
-	if errr != nil {
-		log.Fatal(errr)
+func unregisterHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-token")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// read the x-token header
+	token := r.Header.Get("x-token")
+	if token == "" {
+		returnJsonError(w, r, errors.New("x-token header is missing"), http.StatusBadRequest)
+		return
+	}
+	// verify the token before trusting the user id it carries
+	identity, ok := verifiedIdentity(w, r, token)
+	if !ok {
+		return
+	}
+	userId := identity.Id
+	// get the course userId from the request body
+	var body CourseRegistrationRequest
+	if !decodeJsonBody(w, r, &body) {
+		return
+	}
+	// register the user to the course
+	err := RemoveUserFromCourse(userId, body.CourseId, apiClient(r))
+	if auditErr := auditLog.Record(newAuditEntry(r, userId, userId, body.CourseId, AuditActionUnregister, err)); auditErr != nil {
+		slog.ErrorContext(r.Context(), "audit log write failed", "error", auditErr)
+	}
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
 	}
+	returnJson(w, r, Message{Message: "User unregistered from the course"})
+}
 
-	// API
+// registerRoutes registers every route of the API with its documentation
+func registerRoutes(rt *router, legacy *legacyAliases) {
+	v1 := rt.version("/v1", legacy)
+	intervalParam := param{name: "interval", in: "query", description: "Adds a series grouped by day or week", example: "week", enum: []string{"day", "week"}}
+	depthParam := func(defaultDepth int) param {
+		return queryParam("depth", "Number of levels of children, between 0 and "+strconv.Itoa(maxTreeDepth)+" (default "+strconv.Itoa(defaultDepth)+")", defaultDepth)
+	}
+	attrsParam := queryParam("attrs", "Adds the attributes of every object", false)
+	courseIdParam := pathParam("id", "Course ID")
+	groupIdParam := pathParam("id", "Group ID")
+	dryRunParam := queryParam("dryRun", "Only tells what would change", false)
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		returnJson(w, "Welcome to the Ytrack Manager API")
+	// every path no other route matches
+	rt.handleHidden("/", notFoundHandler)
+	if !platformConfig.DisableDocs {
+		docs, err := swaggerHandler()
+		if err != nil {
+			log.Fatal(err)
+		}
+		rt.handleHidden("/swagger/", docs)
+		rt.handleHidden("/openapi.json", rt.openAPIHandler())
+	}
+	if !platformConfig.DisableMetrics {
+		rt.handleHidden("/metrics", promhttp.Handler().ServeHTTP)
+	}
+
+	v1.handle("/{$}", welcomeHandler, operation{
+		method: "GET", summary: "Welcome message", response: Message{},
 	})
 
-	http.HandleFunc("/swagger/", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "swagger/"+r.URL.Path[8:])
+	v1.handle("/campus", publicCache(campusHandler), operation{
+		method: "GET", summary: "Get the campus information", response: CampusSummary{},
+		errors: []int{http.StatusNotFound, http.StatusBadGateway},
 	})
 
-	http.HandleFunc("/campus", func(w http.ResponseWriter, r *http.Request) {
-		// print the campus information in json format
-		campus, err := GetCampus(platformConfig.CampusName)
-		if err != nil {
-			returnJsonError(w, err, http.StatusInternalServerError)
-			return
-		}
-		returnJson(w, struct {
-			Id   int    `json:"id"`
-			Name string `json:"name"`
-			Type string `json:"type"`
-		}{
-			Id:   campus.Id,
-			Name: campus.Name,
-			Type: campus.Type,
-		})
+	v1.handle("/campus/tree", publicCache(campusTreeHandler), operation{
+		method: "GET", summary: "Get the object hierarchy of the campus", response: ObjectNode{},
+		params: []param{depthParam(defaultTreeDepth), queryParam("attrs", "Adds the attributes of every object, requires the x-token of a user", false)},
+		errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusBadGateway},
 	})
 
-	http.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
-		returnJson(w, "not implemented yet")
+	v1.handle("/campus/objects/{id}", privateCache(requireUser(objectHandler)), operation{
+		method: "GET", summary: "Get an object with its attributes and children", auth: authUser, response: ObjectNode{},
+		params: []param{pathParam("id", "Object ID"), depthParam(1), attrsParam},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound},
 	})
 
-	http.HandleFunc("/user/name", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "x-token")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		// read the x-token header
-		token := r.Header.Get("x-token")
-		if token == "" {
-			returnJsonError(w, errors.New("x-token header is missing"), http.StatusBadRequest)
-			return
-		}
-		// extract the user id from the token
-		id, err := ExtractId(token)
-		if err != nil {
-			returnJsonError(w, err, http.StatusBadRequest)
-			return
-		}
-		// get the user name
-		firstName, lastName, err := GetUserNames(id, client)
-		if err != nil {
-			returnJsonError(w, err, http.StatusInternalServerError)
-			return
-		}
-		returnJson(w, struct {
-			FirstName string `json:"firstName"`
-			LastName  string `json:"lastName"`
-		}{
-			FirstName: firstName,
-			LastName:  lastName,
-		})
+	v1.handle("/user", privateCache(requireUser(userHandler)), operation{
+		method: "GET", summary: "Get the profile of the user", auth: authUser, response: UserProfile{},
+		errors: []int{http.StatusNotFound},
 	})
 
-	http.HandleFunc("/user/roles", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "x-token")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		// read the x-token header
-		token := r.Header.Get("x-token")
-		if token == "" {
-			returnJsonError(w, errors.New("x-token header is missing"), http.StatusBadRequest)
-			return
-		}
-		// extract the user roles from the token
-		roles, err := ExtractRoles(token)
-		if err != nil {
-			returnJsonError(w, err, http.StatusBadRequest)
-			return
-		}
-		returnJson(w, struct {
-			Roles []string `json:"roles"`
-		}{
-			Roles: roles,
-		})
+	v1.handle("/user/xp", privateCache(requireUser(userXpHandler)), operation{
+		method: "GET", summary: "Get the xp of the user per course", auth: authUser, response: UserXp{},
+		params: []param{intervalParam}, errors: []int{http.StatusNotFound},
 	})
 
-	http.HandleFunc("/user/extractId", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "x-token")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		// read the x-token header
-		token := r.Header.Get("x-token")
-		if token == "" {
-			returnJsonError(w, errors.New("x-token header is missing"), http.StatusBadRequest)
-			return
-		}
-		// extract the user id from the token
-		id, err := ExtractId(token)
-		if err != nil {
-			returnJsonError(w, err, http.StatusBadRequest)
-			return
-		}
-		returnJson(w, struct {
-			Id int `json:"id"`
-		}{
-			Id: id,
-		})
+	v1.handle("/user/progress", privateCache(requireUser(userProgressHandler)), operation{
+		method: "GET", summary: "Get the passed and failed exercises of the user", auth: authUser, response: UserProgress{},
+		params: []param{intervalParam}, errors: []int{http.StatusNotFound},
 	})
 
-	http.HandleFunc("/user/courses", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "x-token")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		// add a delay to test the loading spinner
-		time.Sleep(500 * time.Millisecond)
-		// read the x-token header
-		token := r.Header.Get("x-token")
-		if token == "" {
-			returnJsonError(w, errors.New("x-token header is missing"), http.StatusBadRequest)
-			return
-		}
-		// extract the user id from the token
-		id, err := ExtractId(token)
-		if err != nil {
-			returnJsonError(w, err, http.StatusBadRequest)
-			return
-		}
-		// get the user courses
-		courses, err := GetUserCourses(platformConfig.CampusName, id, client)
-		if err != nil {
-			returnJsonError(w, err, http.StatusInternalServerError)
-			return
-		}
-		if len(courses) == 0 {
-			returnJson(w, []string{})
-		} else {
-			returnJson(w, courses)
-		}
+	v1.handle("/user/audits", privateCache(requireUser(userAuditsHandler)), operation{
+		method: "GET", summary: "Get the audits the user has to perform or performed", auth: authUser, response: UserAudits{},
 	})
 
-	http.HandleFunc("/user/availableCourses", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "x-token")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		// add a delay to test the loading spinner
-		time.Sleep(500 * time.Millisecond)
-		// read the x-token header
-		token := r.Header.Get("x-token")
-		if token == "" {
-			returnJsonError(w, errors.New("x-token header is missing"), http.StatusBadRequest)
-			return
-		}
-		// extract the user id from the token
-		id, err := ExtractId(token)
-		if err != nil {
-			returnJsonError(w, err, http.StatusBadRequest)
-			return
-		}
-		// get the campus courses
-		courses, err := GetCampusCourses(platformConfig.CampusName, client)
-		if err != nil {
-			returnJsonError(w, err, http.StatusInternalServerError)
-			return
-		}
-		// get the user courses
-		userCourses, err := GetUserCourses(platformConfig.CampusName, id, client)
-		if err != nil {
-			returnJsonError(w, err, http.StatusInternalServerError)
-			return
-		}
-		// filter the campus courses to get the available courses
-		var availableCourses []Course
-		for _, course := range courses {
-			found := false
-			for _, userCourse := range userCourses {
-				if course.Id == userCourse.Id {
-					found = true
-					break
-				}
-			}
-			if !found {
-				availableCourses = append(availableCourses, course)
-			}
-		}
-		returnJson(w, availableCourses)
+	v1.handle("/user/audits/received", privateCache(requireUser(receivedAuditsHandler)), operation{
+		method: "GET", summary: "Get the audits of the groups of the user", auth: authUser, response: []PeerAudit{},
 	})
 
-	http.HandleFunc("/campus/courses", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		campus, err := GetCampusCourses(platformConfig.CampusName, client)
-		if err != nil {
-			returnJsonError(w, err, http.StatusInternalServerError)
-			return
-		}
-		returnJson(w, campus)
+	v1.handle("/user/audits/ratio", privateCache(requireUser(auditRatioHandler)), operation{
+		method: "GET", summary: "Get the audit ratio of the user", auth: authUser, response: AuditRatio{},
+		errors: []int{http.StatusNotFound},
 	})
 
-	http.HandleFunc("/campus/courses/register", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-token")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		// read the x-token header
-		token := r.Header.Get("x-token")
-		if token == "" {
-			returnJsonError(w, errors.New("x-token header is missing"), http.StatusBadRequest)
-			return
-		}
-		// extract the user userId from the token
-		userId, err := ExtractId(token)
-		if err != nil {
-			returnJsonError(w, err, http.StatusBadRequest)
-			return
-		}
-		// get the course userId from the request body
-		var body struct {
-			CourseId int `json:"courseId"`
-		}
-		err = json.NewDecoder(r.Body).Decode(&body)
-		if err != nil {
-			returnJsonError(w, err, http.StatusBadRequest)
-			return
-		}
-		err = RegisterUserToCourse(userId, body.CourseId, client)
-		if err != nil {
-			returnJsonError(w, err, http.StatusInternalServerError)
-			return
-		}
-		returnJson(w, struct {
-			Message string `json:"message"`
-		}{
-			Message: "User registered to the course",
-		})
+	v1.handle("/user/groups", privateCache(requireUser(userGroupsHandler)), operation{
+		method: "GET", summary: "Get the groups of the user", auth: authUser, response: []Group{},
+		params: []param{queryParam("eventId", "Only the groups of this event", 0)}, errors: []int{http.StatusNotFound},
 	})
 
-	http.HandleFunc("/campus/courses/unregister", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-token")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		// read the x-token header
-		token := r.Header.Get("x-token")
-		if token == "" {
-			returnJsonError(w, errors.New("x-token header is missing"), http.StatusBadRequest)
-			return
-		}
-		// extract the user userId from the token
-		userId, err := ExtractId(token)
-		if err != nil {
-			returnJsonError(w, err, http.StatusBadRequest)
-			return
-		}
-		// get the course userId from the request body
-		var body struct {
-			CourseId int `json:"courseId"`
-		}
-		err = json.NewDecoder(r.Body).Decode(&body)
-		if err != nil {
-			returnJsonError(w, err, http.StatusBadRequest)
-			return
+	v1.handle("/user/groups/open", privateCache(requireUser(openGroupsHandler)), operation{
+		method: "GET", summary: "Get the groups still open in the events of the user", auth: authUser, response: []Group{},
+		params: []param{queryParam("eventId", "Only the groups of this event", 0)}, errors: []int{http.StatusNotFound},
+	})
+
+	v1.handle("/user/name", privateCache(userNameHandler), operation{
+		method: "GET", summary: "Get the first and last name of the user", auth: authUser, response: UserNames{},
+	})
+
+	v1.handle("/user/roles", privateCache(userRolesHandler), operation{
+		method: "GET", summary: "Get the roles of the user", auth: authUser, response: UserRoles{},
+	})
+
+	v1.handle("/user/extractId", privateCache(extractIdHandler), operation{
+		method: "GET", summary: "Get the id of the user", auth: authUser, response: UserId{},
+	})
+
+	v1.handle("/user/courses", privateCache(userCoursesHandler), operation{
+		method: "GET", summary: "Get the courses the user is registered to", auth: authUser, response: []Course{},
+		errors: []int{http.StatusNotFound},
+	})
+
+	v1.handle("/user/availableCourses", privateCache(availableCoursesHandler), operation{
+		method: "GET", summary: "Get the campus courses split between the ones the user is registered to and the available ones",
+		auth: authUser, response: CourseViews{}, errors: []int{http.StatusNotFound},
+	})
+
+	v1.handle("/campus/courses", publicCache(campusCoursesHandler), operation{
+		method: "GET", summary: "Get a page of the campus courses", response: []Course{}, paginated: true, cors: true,
+		params: []param{
+			queryParam("limit", "Page size, between 1 and "+strconv.Itoa(maxCoursesLimit)+" (default "+strconv.Itoa(defaultCoursesLimit)+")", defaultCoursesLimit),
+			queryParam("offset", "Number of courses to skip, cannot be combined with cursor", 0),
+			queryParam("cursor", "The nextCursor of the previous page, it must be used with the same sort", ""),
+			{name: "sort", in: "query", description: "Sort field, prefixed with - for descending order (default id)", example: "name",
+				enum: []string{"id", "-id", "name", "-name", "startAt", "-startAt"}},
+			queryParam("q", "Case insensitive search on the course name", "piscine"),
+			queryParam("startFrom", "Only the courses starting on or after this date", "2024-09-01"),
+			queryParam("startTo", "Only the courses starting before this date", "2025-01-01"),
+		},
+		errors: []int{http.StatusBadRequest},
+	})
+
+	v1.handle("/campus/courses/{id}/participants", noStore(requireAdmin(participantsHandler)), operation{
+		method: "GET", summary: "Export the participants of a course", auth: authAdmin,
+		description: "The format is picked from the format parameter or the Accept header, the total is also sent in X-Total-Count.",
+		response:    []map[string]interface{}{}, paginated: true, produces: []string{"text/csv", xlsxMimeType},
+		params: []param{
+			courseIdParam,
+			queryParam("limit", "Page size, between 1 and "+strconv.Itoa(maxParticipantsLimit)+" (default "+strconv.Itoa(defaultParticipantsLimit)+")", defaultParticipantsLimit),
+			queryParam("offset", "Number of participants to skip", 0),
+			queryParam("columns", "Comma separated list of columns among "+strings.Join(participantColumns, ", "), "login,firstName,lastName"),
+			{name: "format", in: "query", description: "Overrides the Accept header", example: "csv", enum: []string{"json", "csv", "xlsx"}},
+		},
+		errors: []int{http.StatusMethodNotAllowed, http.StatusNotAcceptable},
+	})
+
+	v1.handle("/campus/calendar.ics", publicCache(campusCalendarHandler), operation{
+		method: "GET", summary: "iCalendar feed of the upcoming campus courses", produces: []string{"text/calendar"},
+		errors: []int{http.StatusNotFound, http.StatusBadGateway},
+	})
+
+	v1.handle("/user/calendar.ics", privateCache(userCalendarHandler), operation{
+		method: "GET", summary: "iCalendar feed of the courses of the user", auth: authFeedToken, produces: []string{"text/calendar"},
+		errors: []int{http.StatusNotFound},
+	})
+
+	v1.handle("/user/calendar/token", noStore(requireUser(calendarTokenHandler)), operation{
+		method: "POST", summary: "Issue a calendar feed token, the previous one stops working", auth: authUser, response: CalendarToken{},
+	}, operation{
+		method: "DELETE", summary: "Revoke the calendar feed token", auth: authUser, response: Message{},
+	})
+
+	v1.handle("/campus/courses/register", noStore(registerHandler), operation{
+		method: "POST", summary: "Register the user to a course", auth: authUser,
+		request: CourseRegistrationRequest{}, response: Message{},
+	})
+
+	v1.handle("/campus/courses/unregister", noStore(unregisterHandler), operation{
+		method: "POST", summary: "Unregister the user from a course", auth: authUser,
+		request: CourseRegistrationRequest{}, response: Message{},
+	})
+
+	// Admin
+
+	v1.handle("/admin/audit", noStore(requireAdmin(auditLogHandler)), operation{
+		method: "GET", summary: "Query the registration audit log, newest first", auth: authAdmin,
+		response: []AuditEntry{}, produces: []string{"text/csv", "application/x-ndjson"},
+		params: []param{
+			queryParam("actorId", "Only the changes made by this user", 0),
+			queryParam("userId", "Only the changes of the registrations of this user", 0),
+			queryParam("eventId", "Only the changes of this course", 0),
+			queryParam("action", "register or unregister", AuditActionRegister),
+			queryParam("result", "success or failure", AuditResultSuccess),
+			queryParam("from", "RFC 3339 date of the oldest entry", "2024-09-01T00:00:00Z"),
+			queryParam("to", "RFC 3339 date of the newest entry", "2024-10-01T00:00:00Z"),
+			queryParam("limit", "Maximum number of entries", 100),
+			{name: "format", in: "query", description: "Export format (default json)", example: "csv", enum: []string{"json", "csv", "jsonl"}},
+		},
+		errors: []int{http.StatusBadRequest},
+	})
+	v1.handle("/admin/courses/{id}/register", noStore(requireAdmin(adminRegistrationHandler(AuditActionRegister))), operation{
+		method: "POST", summary: "Register any user to a course", auth: authAdmin,
+		params: []param{courseIdParam, dryRunParam}, request: AdminRegistrationRequest{}, response: AdminRegistrationResult{},
+		errors: []int{http.StatusMethodNotAllowed},
+	})
+	v1.handle("/admin/courses/{id}/unregister", noStore(requireAdmin(adminRegistrationHandler(AuditActionUnregister))), operation{
+		method: "POST", summary: "Unregister any user from a course", auth: authAdmin,
+		params: []param{courseIdParam, dryRunParam}, request: AdminRegistrationRequest{}, response: AdminRegistrationResult{},
+		errors: []int{http.StatusMethodNotAllowed},
+	})
+	v1.handle("/admin/courses/{id}/bulk-register", noStore(requireAdmin(bulkRegisterHandler)), operation{
+		method: "POST", summary: "Register many users to a course from a CSV file or a JSON list of ids and logins", auth: authAdmin,
+		description: "Users already registered are skipped so the same file can safely be uploaded again.",
+		params:      []param{courseIdParam, dryRunParam, queryParam("reason", "Why the users are registered, a JSON body may set it instead", "")},
+		request: struct {
+			Users  []interface{} `json:"users"`
+			Reason string        `json:"reason,omitempty"`
+		}{},
+		requestTypes: []string{"text/csv"}, response: BulkResult{},
+		errors: []int{http.StatusMethodNotAllowed, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+	})
+	v1.handle("/admin/cache", noStore(requireAdmin(cacheHandler)), operation{
+		method: "GET", summary: "Get the cache statistics", auth: authAdmin, response: CacheStats{},
+	}, operation{
+		method: "DELETE", summary: "Empty the caches", auth: authAdmin, response: Message{},
+	})
+	v1.handle("/admin/groups", noStore(requireAdmin(createGroupHandler)), operation{
+		method: "POST", summary: "Create a group", auth: authAdmin, request: CreateGroupRequest{}, response: Group{},
+		status: http.StatusCreated, errors: []int{http.StatusMethodNotAllowed},
+	})
+	v1.handle("/admin/groups/{id}", noStore(requireAdmin(disbandGroupHandler)), operation{
+		method: "DELETE", summary: "Disband a group", auth: authAdmin, params: []param{groupIdParam}, response: Message{},
+		errors: []int{http.StatusMethodNotAllowed, http.StatusNotFound},
+	})
+	v1.handle("/admin/groups/{id}/merge", noStore(requireAdmin(mergeGroupHandler)), operation{
+		method: "POST", summary: "Merge another group into this one", auth: authAdmin,
+		params: []param{groupIdParam}, request: MergeGroupRequest{}, response: Group{},
+		errors: []int{http.StatusMethodNotAllowed, http.StatusNotFound, http.StatusConflict},
+	})
+}
+
+func main() {
+	openapiPath := flag.String("openapi", "", "write the OpenAPI document to this file and exit")
+	flag.Parse()
+	if *openapiPath != "" {
+		rt := newRouter()
+		registerRoutes(rt, nil)
+		data, err := rt.openAPIJson()
+		if err == nil {
+			err = os.WriteFile(*openapiPath, data, 0644)
 		}
-		// register the user to the course
-		err = RemoveUserFromCourse(userId, body.CourseId, client)
 		if err != nil {
-			returnJsonError(w, err, http.StatusInternalServerError)
-			return
+			log.Fatal(err)
 		}
-		returnJson(w, struct {
-			Message string `json:"message"`
-		}{
-			Message: "User unregistered from the course",
-		})
-	})
+		return
+	}
+
+	var errr error
+
+	platformConfig, errr = tools.LoadConfigFromFile("config.json")
+	if errr != nil {
+		log.Fatal(errr)
+	}
+	if errr = setupLogger(platformConfig.Log, platformConfig.LocalStart); errr != nil {
+		log.Fatal(errr)
+	}
+	shutdownTracing, errr := setupTracing(context.Background(), platformConfig.Tracing)
+	if errr != nil {
+		log.Fatal(errr)
+	}
+	auditLog = NewAuditLog(platformConfig.AuditLogPath)
+	feedTokens, errr = LoadFeedTokenStore(platformConfig.CalendarTokensPath)
+	if errr != nil {
+		log.Fatal(errr)
+	}
+	if errr = validateFaultConfig(platformConfig.FaultInjection); errr != nil {
+		log.Fatal(errr)
+	}
+	logFaultInjection()
+	loadCaches(platformConfig.Cache)
+	setupRateLimits(platformConfig.RateLimit)
+	if errr = setupTrustedProxies(platformConfig.TrustedProxies); errr != nil {
+		log.Fatal(errr)
+	}
+	prometheus.MustRegister(cacheCollector{})
+	if errr = allowQueryOperations("queries"); errr != nil {
+		log.Fatal(errr)
+	}
+
+	client, errr = ApiInterface.NewClient(platformConfig.Domain)
+	if errr != nil {
+		log.Fatal(errr)
+	}
+
+	// API
+
+	legacy, errr := newLegacyAliases(platformConfig.LegacyRoutes)
+	if errr != nil {
+		log.Fatal(errr)
+	}
+	rt := newRouter()
+	registerRoutes(rt, legacy)
 
 	// read in the config file if this is a local environment
+	var server *http.Server
 	if platformConfig.LocalStart == true {
-		fmt.Println("Server started on port 8080")
-		log.Fatalln(http.ListenAndServe(":8080", nil))
+		server = &http.Server{Addr: ":8080", Handler: rt.mux}
 	} else {
 		port := os.Getenv("PORT")
-		fmt.Println("Server started on port " + port)
 		addr := net.JoinHostPort("::", port)
-		server := &http.Server{Addr: addr}
-		log.Fatalln(server.ListenAndServe())
+		server = &http.Server{Addr: addr, Handler: rt.mux}
+	}
+	slog.Info("server started", "addr", server.Addr)
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalln(err)
+		}
+	}()
+
+	// stop gracefully so that the caches can be saved
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("shutdown failed", "error", err)
+	}
+	saveCaches()
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("traces not flushed", "error", err)
 	}
 
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseCourseViews(t *testing.T) {
+	events := `[
+		{"id": 1, "object": {"campus": "rouen", "name": "Piscine Go"}, "usersRelation": [{"userId": 7}]},
+		{"id": 2, "object": {"campus": "rouen", "name": "Piscine JS"}, "usersRelation": []}
+	]`
+	tests := []struct {
+		name       string
+		response   string
+		err        error
+		registered int
+		available  int
+	}{
+		{"known user", `{"user": [{"id": 7}], "event": ` + events + `}`, nil, 1, 1},
+		{"unknown user", `{"user": [], "event": ` + events + `}`, ErrUserNotFound, 0, 0},
+	}
+	for _, test := range tests {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(test.response), &data); err != nil {
+			t.Fatal(err)
+		}
+		views, err := parseCourseViews(data)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, expected %v", test.name, err, test.err)
+		}
+		if len(views.Registered) != test.registered || len(views.Available) != test.available {
+			t.Errorf("%s: got %d registered and %d available courses, expected %d and %d",
+				test.name, len(views.Registered), len(views.Available), test.registered, test.available)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"Ytrack-Manager/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The label of the values left out of an allow-list
+const otherLabel = "other"
+
+// The distinct event ids counted under their own label, the later ones are counted as other
+const maxEventLabels = 500
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route pattern, method and status.",
+	}, []string{"route", "method", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of the HTTP requests by route pattern and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	registrations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "course_registrations_total",
+		Help: "Users registered to or removed from a course by event id and action (register or unregister).",
+	}, []string{"event_id", "action"})
+)
+
+var allowedMethods = map[string]bool{"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true}
+
+// eventLabels admits the first maxEventLabels event ids as labels
+var eventLabels = struct {
+	sync.Mutex
+	ids map[int]bool
+}{ids: make(map[int]bool)}
+
+func methodLabel(method string) string {
+	if allowedMethods[method] {
+		return method
+	}
+	return otherLabel
+}
+
+func eventLabel(eventId int) string {
+	eventLabels.Lock()
+	defer eventLabels.Unlock()
+	if !eventLabels.ids[eventId] {
+		if len(eventLabels.ids) >= maxEventLabels {
+			return otherLabel
+		}
+		eventLabels.ids[eventId] = true
+	}
+	return strconv.Itoa(eventId)
+}
+
+// countRegistrations records the users registered to or removed from the course
+func countRegistrations(eventId int, action string, users int) {
+	registrations.WithLabelValues(eventLabel(eventId), action).Add(float64(users))
+}
+
+// observeRequest records the status and the latency of the request. The route is the registered
+// pattern, never the path, so that the number of series stays bounded.
+func observeRequest(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		method := methodLabel(r.Method)
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(recorder.status)).Inc()
+		httpDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// allowQueryOperations uses the names of the operations of the query files as the labels of the GraphQL
+// metrics
+func allowQueryOperations(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.graphql"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if name := ApiInterface.OperationName(string(content)); name != "" {
+			ApiInterface.AllowOperations(name)
+		}
+	}
+	return nil
+}
+
+var (
+	cacheLookupsDesc = prometheus.NewDesc("cache_lookups_total",
+		"Cache lookups by cache and result (hit, stale or miss).", []string{"cache", "result"}, nil)
+	cacheEvictionsDesc = prometheus.NewDesc("cache_evictions_total",
+		"Entries evicted to make room for new ones by cache.", []string{"cache"}, nil)
+	cacheRefreshErrorsDesc = prometheus.NewDesc("cache_refresh_errors_total",
+		"Failed background refreshes of stale entries by cache.", []string{"cache"}, nil)
+	cacheSizeDesc = prometheus.NewDesc("cache_entries",
+		"Entries held by cache.", []string{"cache"}, nil)
+)
+
+// cacheCollector exposes the counters of the caches when the metrics are scraped
+type cacheCollector struct{}
+
+func (cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheLookupsDesc
+	ch <- cacheEvictionsDesc
+	ch <- cacheRefreshErrorsDesc
+	ch <- cacheSizeDesc
+}
+
+func (cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, stats := range map[string]cache.Stats{
+		"campus":       campusCache.Stats(),
+		"courses":      coursesCache.Stats(),
+		"course_pages": coursePageCache.Stats(),
+		"campus_tree":  campusTreeCache.Stats(),
+	} {
+		ch <- prometheus.MustNewConstMetric(cacheLookupsDesc, prometheus.CounterValue, float64(stats.Hits), name, "hit")
+		ch <- prometheus.MustNewConstMetric(cacheLookupsDesc, prometheus.CounterValue, float64(stats.StaleHits), name, "stale")
+		ch <- prometheus.MustNewConstMetric(cacheLookupsDesc, prometheus.CounterValue, float64(stats.Misses), name, "miss")
+		ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions), name)
+		ch <- prometheus.MustNewConstMetric(cacheRefreshErrorsDesc, prometheus.CounterValue, float64(stats.RefreshErrors), name)
+		ch <- prometheus.MustNewConstMetric(cacheSizeDesc, prometheus.GaugeValue, float64(stats.Size), name)
+	}
+}
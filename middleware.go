@@ -0,0 +1,189 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type contextKey string
+
+const (
+	// The key used to store the id of the authenticated user in the request context
+	userIdKey contextKey = "userId"
+)
+
+// hasAnyRole reports whether one of the roles is part of the allowed roles
+func hasAnyRole(roles []string, allowed []string) bool {
+	for _, role := range roles {
+		for _, a := range allowed {
+			if role == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authenticate verifies the x-token header and returns the id and the roles of the user it belongs to
+func authenticate(w http.ResponseWriter, r *http.Request) (int, []string, bool) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-token")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return 0, nil, false
+	}
+	// read the x-token header
+	token := r.Header.Get("x-token")
+	if token == "" {
+		returnJsonError(w, r, errors.New("x-token header is missing"), http.StatusBadRequest)
+		return 0, nil, false
+	}
+	identity, ok := verifiedIdentity(w, r, token)
+	if !ok {
+		return 0, nil, false
+	}
+	return identity.Id, identity.Roles, true
+}
+
+// requireUser only lets through requests with a valid x-token, the id of the user is then available in the request context
+func requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userIdKey, id)))
+	}
+}
+
+// requireAdmin only lets through requests whose x-token carries one of the configured admin roles,
+// the id of the admin is then available in the request context
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, roles, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		if !hasAnyRole(roles, platformConfig.AdminRoles) {
+			returnJsonError(w, r, errors.New("admin role required"), http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userIdKey, id)))
+	}
+}
+
+// contextUserId returns the id stored in the request context by requireUser or requireAdmin
+func contextUserId(r *http.Request) int {
+	id, _ := r.Context().Value(userIdKey).(int)
+	return id
+}
+
+// The proxies whose X-Forwarded-For header is trusted, set by setupTrustedProxies
+var trustedProxies []netip.Prefix
+
+// setupTrustedProxies parses the addresses and CIDR ranges of the trusted proxies
+func setupTrustedProxies(proxies []string) error {
+	trustedProxies = nil
+	for _, proxy := range proxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return errors.New("invalid trusted proxy " + proxy + ", expected an ip address or a CIDR range")
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		trustedProxies = append(trustedProxies, prefix.Masked())
+	}
+	return nil
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHost returns the address the request was received from, without its port
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// fromTrustedProxy reports whether the request was received from one of the trusted proxies, the only
+// ones whose forwarding headers can be believed
+func fromTrustedProxy(r *http.Request) bool {
+	addr, err := netip.ParseAddr(remoteHost(r))
+	return err == nil && isTrustedProxy(addr)
+}
+
+// clientIp returns the address of the client. X-Forwarded-For is written by the client as much as by the
+// proxies, so it is only read when the request comes from a trusted proxy, and only the hops appended by
+// trusted proxies are skipped: the address is the last one that is not a trusted proxy.
+func clientIp(r *http.Request) string {
+	remote := remoteHost(r)
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !isTrustedProxy(addr) {
+		return remote
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client := addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return client.Unmap().String()
+}
+
+// requestId returns the X-Request-ID sent by the client, or generates one and keeps it on the request
+// so that every later call returns the same id. Ids that are too long or contain anything but letters,
+// digits, dots, dashes and underscores are replaced, they end up in the logs.
+func requestId(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); validRequestId(id) {
+		return id
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	id := hex.EncodeToString(b)
+	r.Header.Set("X-Request-ID", id)
+	return id
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// apiClient returns the Ytrack client bound to the request, its calls carry the request id and stop when
+// the client goes away
+func apiClient(r *http.Request) *ApiInterface.Client {
+	return client.WithContext(r.Context())
+}
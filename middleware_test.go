@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIp(t *testing.T) {
+	if err := setupTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+	defer setupTrustedProxies(nil)
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expected     string
+	}{
+		{"direct client", "203.0.113.5:4000", nil, "203.0.113.5"},
+		{"spoofed header from an untrusted client", "203.0.113.5:4000", []string{"198.51.100.7"}, "203.0.113.5"},
+		{"trusted proxy", "10.1.2.3:4000", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"client prepending a fake hop", "10.1.2.3:4000", []string{"1.1.1.1, 198.51.100.7"}, "198.51.100.7"},
+		{"chain of trusted proxies", "10.1.2.3:4000", []string{"198.51.100.7, 192.0.2.1", "10.9.9.9"}, "198.51.100.7"},
+		{"trusted proxy without header", "192.0.2.1:4000", nil, "192.0.2.1"},
+		{"garbage hop", "10.1.2.3:4000", []string{"not-an-ip"}, "10.1.2.3"},
+		{"ipv6 client", "[2001:db8::1]:4000", nil, "2001:db8::1"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		for _, value := range test.forwardedFor {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if ip := clientIp(r); ip != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.name, ip, test.expected)
+		}
+	}
+}
+
+func TestSetupTrustedProxiesRejectsInvalidAddresses(t *testing.T) {
+	defer setupTrustedProxies(nil)
+	if err := setupTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Error("expected an error for a host name")
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:generate go run . -openapi swagger/openapi.json
+
+// authScheme is the authentication an operation requires
+type authScheme int
+
+const (
+	authNone authScheme = iota
+	// a valid x-token header
+	authUser
+	// an x-token carrying one of the configured admin roles
+	authAdmin
+	// a calendar feed token in the token query parameter
+	authFeedToken
+)
+
+// operation documents one method of a route, the OpenAPI document is generated from these annotations
+type operation struct {
+	method      string
+	summary     string
+	description string
+	auth        authScheme
+	params      []param
+	// request is a value of the type of the JSON body, nil when the operation reads no body
+	request interface{}
+	// requestTypes are the other media types accepted for the body, documented as plain strings
+	requestTypes []string
+	// response is a value of the type of the data of the response envelope
+	response interface{}
+	// status is the status of the successful response, 200 when zero
+	status    int
+	paginated bool
+	// produces are the other media types of the successful response, documented as plain strings
+	produces []string
+	// errors are the statuses of the problems the operation may return on top of the ones implied by its auth
+	errors []int
+	// cors is set on the operations answering preflight requests without requiring a token
+	cors bool
+}
+
+// param documents a query or path parameter, its type is the type of example
+type param struct {
+	name        string
+	in          string
+	description string
+	example     interface{}
+	enum        []string
+	required    bool
+}
+
+// queryParam documents an optional query parameter
+func queryParam(name string, description string, example interface{}) param {
+	return param{name: name, in: "query", description: description, example: example}
+}
+
+// pathParam documents a path wildcard
+func pathParam(name string, description string) param {
+	return param{name: name, in: "path", description: description, example: 1, required: true}
+}
+
+var wildcardPattern = regexp.MustCompile(`\{([^}.$]+)(\.\.\.)?\}`)
+
+// openAPIPath converts a mux pattern to an OpenAPI path, "/v1/{$}" becomes "/v1/"
+func openAPIPath(pattern string) string {
+	pattern = strings.TrimSuffix(pattern, "{$}")
+	return wildcardPattern.ReplaceAllString(pattern, "{$1}")
+}
+
+// schemaBuilder generates the JSON schemas of Go types, named structs are added to the components once
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(b.schema(t.Elem()))
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := b.components[t.Name()]; !ok {
+			// registered before building the properties so recursive types end
+			b.components[t.Name()] = nil
+			b.components[t.Name()] = b.structSchema(t)
+		}
+		return ref
+	}
+	// interface{} and anything else accept any value
+	return map[string]interface{}{}
+}
+
+// nullable allows null on top of the schema
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if t, ok := schema["type"].(string); ok {
+		nullableSchema := make(map[string]interface{}, len(schema))
+		for k, v := range schema {
+			nullableSchema[k] = v
+		}
+		nullableSchema["type"] = []string{t, "null"}
+		return nullableSchema
+	}
+	return map[string]interface{}{"anyOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+}
+
+// structSchema lists the fields serialized by encoding/json, the ones without omitempty are required
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer && strings.Contains(options, "omitempty") {
+			// a nil pointer is left out rather than serialized as null
+			fieldType = fieldType.Elem()
+		}
+		properties[name] = b.schema(fieldType)
+		if rules := field.Tag.Get("validate"); rules != "" {
+			validationKeywords(properties[name].(map[string]interface{}), field.Type, rules)
+		}
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// validationKeywords translates the min and max rules of a validate tag to the JSON Schema keywords
+// decodeJsonBody enforces
+func validationKeywords(schema map[string]interface{}, t reflect.Type, rules string) {
+	for _, rule := range strings.Split(rules, ",") {
+		key, arg, _ := strings.Cut(rule, "=")
+		bound, err := strconv.ParseFloat(arg, 64)
+		if err != nil || (key != "min" && key != "max") {
+			continue
+		}
+		keyword := map[string]string{"min": "minimum", "max": "maximum"}[key]
+		switch t.Kind() {
+		case reflect.String:
+			keyword = map[string]string{"min": "minLength", "max": "maxLength"}[key]
+		case reflect.Slice:
+			keyword = map[string]string{"min": "minItems", "max": "maxItems"}[key]
+		}
+		schema[keyword] = bound
+	}
+}
+
+// problemResponse documents an application/problem+json error
+func (b *schemaBuilder) problemResponse(status int) map[string]interface{} {
+	return map[string]interface{}{
+		"description": http.StatusText(status),
+		"content": map[string]interface{}{
+			"application/problem+json": map[string]interface{}{"schema": b.schema(reflect.TypeOf(Problem{}))},
+		},
+	}
+}
+
+func stringContent(mediaTypes []string, content map[string]interface{}) {
+	for _, mediaType := range mediaTypes {
+		content[mediaType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+	}
+}
+
+// errorStatuses returns the sorted statuses of the problems the operation may return
+func (op operation) errorStatuses() []int {
+	// every route goes through rateLimit
+	set := map[int]bool{http.StatusTooManyRequests: true, http.StatusInternalServerError: true}
+	switch op.auth {
+	case authUser, authAdmin:
+		// see verifyToken, 502 when Ytrack cannot verify the token
+		set[http.StatusBadRequest] = true
+		set[http.StatusUnauthorized] = true
+		set[http.StatusBadGateway] = true
+		if op.auth == authAdmin {
+			set[http.StatusForbidden] = true
+		}
+	case authFeedToken:
+		set[http.StatusUnauthorized] = true
+	}
+	if op.request != nil {
+		// see decodeJsonBody
+		set[http.StatusBadRequest] = true
+		set[http.StatusRequestEntityTooLarge] = true
+	}
+	for _, status := range op.errors {
+		set[status] = true
+	}
+	statuses := make([]int, 0, len(set))
+	for status := range set {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	return statuses
+}
+
+func (b *schemaBuilder) operation(op operation, path string) map[string]interface{} {
+	doc := map[string]interface{}{"summary": op.summary}
+	if op.description != "" {
+		doc["description"] = op.description
+	}
+	switch op.auth {
+	case authUser, authAdmin:
+		doc["security"] = []interface{}{map[string]interface{}{"TokenAuth": []string{}}}
+	case authFeedToken:
+		doc["security"] = []interface{}{map[string]interface{}{"FeedToken": []string{}}}
+	}
+
+	var params []interface{}
+	documented := map[string]bool{}
+	for _, p := range op.params {
+		documented[p.in+p.name] = true
+		schema := b.schema(reflect.TypeOf(p.example))
+		if len(p.enum) > 0 {
+			schema["enum"] = p.enum
+		}
+		if p.in == "query" && p.example != "" {
+			schema["examples"] = []interface{}{p.example}
+		}
+		params = append(params, map[string]interface{}{
+			"name": p.name, "in": p.in, "required": p.required, "description": p.description, "schema": schema,
+		})
+	}
+	for _, match := range wildcardPattern.FindAllStringSubmatch(path, -1) {
+		if !documented["path"+match[1]] {
+			params = append(params, map[string]interface{}{
+				"name": match[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "integer"},
+			})
+		}
+	}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+
+	if op.request != nil || len(op.requestTypes) > 0 {
+		content := map[string]interface{}{}
+		if op.request != nil {
+			content["application/json"] = map[string]interface{}{"schema": b.schema(reflect.TypeOf(op.request))}
+		}
+		stringContent(op.requestTypes, content)
+		doc["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	content := map[string]interface{}{}
+	if op.response != nil {
+		properties := map[string]interface{}{"data": b.schema(reflect.TypeOf(op.response))}
+		required := []string{"data"}
+		if op.paginated {
+			properties["pagination"] = b.schema(reflect.TypeOf(Pagination{}))
+			required = append(required, "pagination")
+		}
+		content["application/json"] = map[string]interface{}{"schema": map[string]interface{}{
+			"type": "object", "properties": properties, "required": required,
+		}}
+	}
+	stringContent(op.produces, content)
+	success := map[string]interface{}{"description": http.StatusText(status), "content": content}
+	responses := map[string]interface{}{strconv.Itoa(status): success}
+	if op.method == "GET" && op.response != nil {
+		success["headers"] = map[string]interface{}{
+			"ETag":          map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+			"Cache-Control": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+		}
+		responses["304"] = map[string]interface{}{"description": "Not modified, the ETag given in If-None-Match still matches"}
+	}
+	for _, errorStatus := range op.errorStatuses() {
+		responses[strconv.Itoa(errorStatus)] = b.problemResponse(errorStatus)
+	}
+	seconds := map[string]interface{}{"schema": map[string]interface{}{"type": "integer"}}
+	responses["429"].(map[string]interface{})["headers"] = map[string]interface{}{
+		"Retry-After":         seconds,
+		"RateLimit-Limit":     seconds,
+		"RateLimit-Remaining": seconds,
+		"RateLimit-Reset":     seconds,
+	}
+	doc["responses"] = responses
+	return doc
+}
+
+// preflightOperation documents the answer to CORS preflight requests
+func preflightOperation(methods []string) map[string]interface{} {
+	header := func(value string) map[string]interface{} {
+		return map[string]interface{}{"schema": map[string]interface{}{"type": "string", "examples": []string{value}}}
+	}
+	return map[string]interface{}{
+		"summary": "CORS preflight",
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "The request may be sent from any origin",
+				"headers": map[string]interface{}{
+					"Access-Control-Allow-Origin":  header("*"),
+					"Access-Control-Allow-Methods": header(strings.Join(append(methods, "OPTIONS"), ", ")),
+					"Access-Control-Allow-Headers": header("Content-Type, x-token"),
+				},
+			},
+		},
+	}
+}
+
+// openAPI generates the OpenAPI 3.1 document of the documented routes
+func (rt *router) openAPI() map[string]interface{} {
+	b := &schemaBuilder{components: map[string]interface{}{}}
+	paths := map[string]interface{}{}
+	for _, rte := range rt.routes {
+		if rte.hidden {
+			continue
+		}
+		item := map[string]interface{}{}
+		var corsMethods []string
+		for _, op := range rte.operations {
+			item[strings.ToLower(op.method)] = b.operation(op, rte.pattern)
+			if op.cors || op.auth == authUser || op.auth == authAdmin {
+				corsMethods = append(corsMethods, op.method)
+			}
+		}
+		if len(corsMethods) > 0 {
+			item["options"] = preflightOperation(corsMethods)
+		}
+		paths[openAPIPath(rte.pattern)] = item
+	}
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   "Ytrack Manager API",
+			"version": "1.0.0",
+			"description": "API for managing Ytrack platform users, courses, and campus information. " +
+				"JSON responses are wrapped in an envelope with the payload under data, lists add a pagination object. " +
+				"Errors are application/problem+json documents (RFC 7807). " +
+				"The unprefixed paths are deprecated aliases of the /v1 routes answering with Deprecation and Sunset headers until the sunset date. " +
+				"They keep the responses of the API before it was versioned: the data without envelope, errors as {\"error\": message} " +
+				"and the former shapes of /, /campus/courses and /user/availableCourses.",
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": "https://yskills.alwaysdata.net", "description": "Hosted API"},
+			map[string]interface{}{"url": "http://localhost:8080", "description": "Local API"},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.components,
+			"securitySchemes": map[string]interface{}{
+				"TokenAuth": map[string]interface{}{
+					"type": "apiKey", "in": "header", "name": "x-token",
+					"description": "The Ytrack JWT of the user, its signature and expiry are checked with Ytrack",
+				},
+				"FeedToken": map[string]interface{}{"type": "apiKey", "in": "query", "name": "token"},
+			},
+		},
+	}
+}
+
+// openAPIJson returns the indented OpenAPI document
+func (rt *router) openAPIJson() ([]byte, error) {
+	data, err := json.MarshalIndent(rt.openAPI(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// openAPIHandler serves the OpenAPI document generated from the routes of the router
+func (rt *router) openAPIHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := rt.openAPIJson()
+		if err != nil {
+			returnJsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		if _, err = w.Write(data); err != nil {
+			slog.WarnContext(r.Context(), "response write failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestRoutesAreDocumented(t *testing.T) {
+	rt := newRouter()
+	registerRoutes(rt, nil)
+	for _, route := range rt.routes {
+		if route.hidden {
+			continue
+		}
+		if len(route.operations) == 0 {
+			t.Errorf("%s is registered without documentation", route.pattern)
+		}
+		methods := map[string]bool{}
+		for _, op := range route.operations {
+			if op.method == "" || op.summary == "" {
+				t.Errorf("%s has an operation without method or summary", route.pattern)
+			}
+			if op.response == nil && len(op.produces) == 0 {
+				t.Errorf("%s %s does not document its response", op.method, route.pattern)
+			}
+			if methods[op.method] {
+				t.Errorf("%s %s is documented twice", op.method, route.pattern)
+			}
+			methods[op.method] = true
+		}
+	}
+}
+
+func TestOpenAPIDocumentIsUpToDate(t *testing.T) {
+	rt := newRouter()
+	registerRoutes(rt, nil)
+	generated, err := rt.openAPIJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("swagger/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(generated, committed) {
+		t.Error("swagger/openapi.json is outdated, run go generate")
+	}
+}
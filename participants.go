@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultParticipantsLimit = 100
+	maxParticipantsLimit     = 1000
+)
+
+// The columns that can be selected with the columns parameter, in their default order
+var participantColumns = []string{"id", "login", "firstName", "lastName", "registeredAt"}
+
+func (p Participant) column(name string) interface{} {
+	switch name {
+	case "id":
+		return p.Id
+	case "login":
+		return p.Login
+	case "firstName":
+		return p.FirstName
+	case "lastName":
+		return p.LastName
+	case "registeredAt":
+		return p.RegisteredAt
+	}
+	return nil
+}
+
+// participantRow is a participant restricted to the selected columns, it is serialized as a JSON object
+// whose keys keep the order of the columns
+type participantRow struct {
+	columns []string
+	values  []interface{}
+}
+
+func (row participantRow) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, column := range row.columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(row.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// escapeFormula prefixes the text cells a spreadsheet would evaluate as a formula with a quote, so that
+// names chosen by users cannot run formulas in the exports
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// parsePagination reads the limit and offset parameters
+func parsePagination(values url.Values, defaultLimit int, maxLimit int) (int, int, error) {
+	limit, offset := defaultLimit, 0
+	var err error
+	if v := values.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxLimit {
+			return 0, 0, errors.New("invalid limit parameter, expected a number between 1 and " + strconv.Itoa(maxLimit))
+		}
+	}
+	if v := values.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset parameter")
+		}
+	}
+	return limit, offset, nil
+}
+
+// parseParticipantColumns reads the comma separated columns parameter, all columns are selected by default
+func parseParticipantColumns(value string) ([]string, error) {
+	if value == "" {
+		return participantColumns, nil
+	}
+	var columns []string
+	for _, column := range strings.Split(value, ",") {
+		column = strings.TrimSpace(column)
+		valid := false
+		for _, c := range participantColumns {
+			if c == column {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, errors.New("unknown column " + column + ", expected one of " + strings.Join(participantColumns, ", "))
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// acceptedFormats are the export formats matching each media range of an Accept header, by preference
+var acceptedFormats = map[string][]string{
+	"*/*":              {"json", "csv", "xlsx"},
+	"application/*":    {"json", "xlsx"},
+	"application/json": {"json"},
+	"text/*":           {"csv"},
+	"text/csv":         {"csv"},
+	xlsxMimeType:       {"xlsx"},
+}
+
+// negotiateFormat picks the export format from the format parameter or, when it is absent, from the Accept header
+// following its quality values, q=0 marking a media type as not acceptable
+func negotiateFormat(r *http.Request) (string, error) {
+	switch r.URL.Query().Get("format") {
+	case "json":
+		return "json", nil
+	case "csv":
+		return "csv", nil
+	case "xlsx":
+		return "xlsx", nil
+	case "":
+	default:
+		return "", errors.New("unsupported format, expected json, csv or xlsx")
+	}
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return "json", nil
+	}
+	type mediaRange struct {
+		formats []string
+		q       float64
+	}
+	var ranges []mediaRange
+	// a format explicitly refused with q=0 is not picked through a wildcard either
+	refused := map[string]bool{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		formats := acceptedFormats[mediaType]
+		if len(formats) == 1 && q == 0 {
+			refused[formats[0]] = true
+		}
+		ranges = append(ranges, mediaRange{formats: formats, q: q})
+	}
+	// the first of the ranges with the highest quality wins
+	format, best := "", 0.0
+	for _, mediaRange := range ranges {
+		if mediaRange.q <= best {
+			continue
+		}
+		for _, f := range mediaRange.formats {
+			if !refused[f] {
+				format, best = f, mediaRange.q
+				break
+			}
+		}
+	}
+	if format != "" {
+		return format, nil
+	}
+	return "", errors.New("none of the accepted media types is supported, expected application/json, text/csv or " + xlsxMimeType)
+}
+
+// participantsHandler exports the users registered to a course as JSON, CSV or XLSX
+func participantsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		returnJsonError(w, r, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	courseId, err := pathCourseId(r)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parsePagination(r.URL.Query(), defaultParticipantsLimit, maxParticipantsLimit)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	columns, err := parseParticipantColumns(r.URL.Query().Get("columns"))
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	format, err := negotiateFormat(r)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusNotAcceptable)
+		return
+	}
+
+	participants, total, err := GetCourseParticipants(courseId, limit, offset, apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	filename := "course-" + strconv.Itoa(courseId) + "-participants"
+
+	switch format {
+	case "json":
+		rows := make([]participantRow, 0, len(participants))
+		for _, participant := range participants {
+			row := participantRow{columns: columns, values: make([]interface{}, 0, len(columns))}
+			for _, column := range columns {
+				row.values = append(row.values, participant.column(column))
+			}
+			rows = append(rows, row)
+		}
+		returnJsonPage(w, r, rows, Pagination{
+			Total:   total,
+			Limit:   limit,
+			Offset:  offset,
+			HasMore: offset+len(rows) < total,
+		})
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename+".csv")
+		writer := csv.NewWriter(w)
+		err = writer.Write(columns)
+		for _, participant := range participants {
+			if err != nil {
+				break
+			}
+			record := make([]string, 0, len(columns))
+			for _, column := range columns {
+				if column == "id" {
+					record = append(record, strconv.Itoa(participant.Id))
+				} else {
+					record = append(record, escapeFormula(participant.column(column).(string)))
+				}
+			}
+			err = writer.Write(record)
+		}
+		writer.Flush()
+		if err == nil {
+			err = writer.Error()
+		}
+	case "xlsx":
+		w.Header().Set("Content-Type", xlsxMimeType)
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename+".xlsx")
+		rows := [][]interface{}{make([]interface{}, 0, len(columns))}
+		for _, column := range columns {
+			rows[0] = append(rows[0], column)
+		}
+		for _, participant := range participants {
+			row := make([]interface{}, 0, len(columns))
+			for _, column := range columns {
+				value := participant.column(column)
+				if text, ok := value.(string); ok {
+					value = escapeFormula(text)
+				}
+				row = append(row, value)
+			}
+			rows = append(rows, row)
+		}
+		err = writeXlsx(w, "Participants", rows)
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "response write failed", "error", err)
+	}
+}
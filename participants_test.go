@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParticipantRowKeepsColumnOrder(t *testing.T) {
+	participant := Participant{Id: 1, Login: "jdoe", FirstName: "John", LastName: "Doe"}
+	columns := []string{"login", "lastName", "id"}
+	row := participantRow{columns: columns}
+	for _, column := range columns {
+		row.values = append(row.values, participant.column(column))
+	}
+	data, err := json.Marshal([]participantRow{row})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `[{"login":"jdoe","lastName":"Doe","id":1}]`; string(data) != expected {
+		t.Errorf("got %s, expected %s", data, expected)
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	tests := map[string]string{
+		"":             "",
+		"John":         "John",
+		"=1+1":         "'=1+1",
+		"+33 6":        "'+33 6",
+		"-2":           "'-2",
+		"@SUM(A1:A2)":  "'@SUM(A1:A2)",
+		"\t=cmd":       "'\t=cmd",
+		"Jean-Pierre":  "Jean-Pierre",
+		"john@doe.com": "john@doe.com",
+	}
+	for value, expected := range tests {
+		if escaped := escapeFormula(value); escaped != expected {
+			t.Errorf("escapeFormula(%q) = %q, expected %q", value, escaped, expected)
+		}
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		query    string
+		accept   string
+		expected string
+	}{
+		{"", "", "json"},
+		{"?format=xlsx", "text/csv", "xlsx"},
+		{"", "text/csv", "csv"},
+		{"", "text/csv;q=0, application/json", "json"},
+		{"", "text/csv;q=0.5, application/json;q=0.9", "json"},
+		{"", "application/json;q=0.1, text/csv", "csv"},
+		{"", "text/html, " + xlsxMimeType + ";q=0.8", "xlsx"},
+		{"", "application/json;q=0, */*", "csv"},
+		{"", "application/json;q=0, text/csv;q=0, */*;q=0.1", "xlsx"},
+		{"", "text/csv;q=0", ""},
+		{"", "text/html", ""},
+		{"?format=pdf", "", ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/v1/campus/courses/1/participants"+test.query, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		format, err := negotiateFormat(r)
+		if format != test.expected || (err != nil) != (test.expected == "") {
+			t.Errorf("%q %q: got %q %v, expected %q", test.query, test.accept, format, err, test.expected)
+		}
+	}
+}
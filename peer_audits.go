@@ -0,0 +1,154 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// PeerAudit is the review of a group project by another student
+type PeerAudit struct {
+	Id        int        `json:"id"`
+	GroupId   int        `json:"groupId"`
+	Path      string     `json:"path"`
+	Captain   string     `json:"captain"`
+	Members   []string   `json:"members"`
+	Auditor   string     `json:"auditor"`
+	Grade     *float64   `json:"grade"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	EndAt     *time.Time `json:"endAt"`
+}
+
+type AuditRatio struct {
+	AuditRatio float64 `json:"auditRatio"`
+	TotalUp    int     `json:"totalUp"`
+	TotalDown  int     `json:"totalDown"`
+}
+
+// UserAudits are the audits of a user split by state
+type UserAudits struct {
+	Pending   []PeerAudit `json:"pending"`
+	Completed []PeerAudit `json:"completed"`
+}
+
+// getPeerAudits runs one of the audit queries and parses the audits it returns
+func getPeerAudits(queryFile string, campusName string, userId int, client *ApiInterface.Client) ([]PeerAudit, error) {
+	query, err := loadQueryFromFile(queryFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.Run(query, map[string]interface{}{"campusName": campusName, "userID": userId})
+	if err != nil {
+		return nil, err
+	}
+	audits := []PeerAudit{}
+	for _, v := range data["audit"].([]interface{}) {
+		audit := v.(map[string]interface{})
+		group := audit["group"].(map[string]interface{})
+		peerAudit := PeerAudit{
+			Id:        int(audit["id"].(float64)),
+			GroupId:   int(group["id"].(float64)),
+			Members:   []string{},
+			CreatedAt: timestampOrZero(audit["createdAt"]),
+			UpdatedAt: timestampOrZero(audit["updatedAt"]),
+			EndAt:     parseTimestamp(audit["endAt"]),
+		}
+		peerAudit.Path, _ = group["path"].(string)
+		peerAudit.Captain, _ = group["captainLogin"].(string)
+		if auditor, ok := audit["auditor"].(map[string]interface{}); ok {
+			peerAudit.Auditor, _ = auditor["login"].(string)
+		}
+		if grade, ok := audit["grade"].(float64); ok {
+			peerAudit.Grade = &grade
+		}
+		for _, m := range group["members"].([]interface{}) {
+			if login, ok := m.(map[string]interface{})["userLogin"].(string); ok {
+				peerAudit.Members = append(peerAudit.Members, login)
+			}
+		}
+		audits = append(audits, peerAudit)
+	}
+	return audits, nil
+}
+
+// GetUserAudits returns the audits the user was assigned as auditor
+func GetUserAudits(campusName string, userId int, client *ApiInterface.Client) ([]PeerAudit, error) {
+	return getPeerAudits("queries/get_user_audits.graphql", campusName, userId, client)
+}
+
+// GetReceivedAudits returns the audits of the groups the user is a member of
+func GetReceivedAudits(campusName string, userId int, client *ApiInterface.Client) ([]PeerAudit, error) {
+	return getPeerAudits("queries/get_received_audits.graphql", campusName, userId, client)
+}
+
+func GetAuditRatio(userId int, client *ApiInterface.Client) (AuditRatio, error) {
+	query, err := loadQueryFromFile("queries/get_audit_ratio.graphql")
+	if err != nil {
+		return AuditRatio{}, err
+	}
+	data, err := client.Run(query, map[string]interface{}{"userID": userId})
+	if err != nil {
+		return AuditRatio{}, err
+	}
+	users := data["user"].([]interface{})
+	if len(users) == 0 {
+		return AuditRatio{}, ErrUserNotFound
+	}
+	user := users[0].(map[string]interface{})
+	var ratio AuditRatio
+	ratio.AuditRatio, _ = user["auditRatio"].(float64)
+	totalUp, _ := user["totalUp"].(float64)
+	totalDown, _ := user["totalDown"].(float64)
+	ratio.TotalUp = int(totalUp)
+	ratio.TotalDown = int(totalDown)
+	return ratio, nil
+}
+
+// userAuditsHandler lists the audits the user still has to perform and the ones already graded,
+// audits that expired without a grade are left out
+func userAuditsHandler(w http.ResponseWriter, r *http.Request) {
+	audits, err := GetUserAudits(platformConfig.CampusName, contextUserId(r), apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	pending, completed := []PeerAudit{}, []PeerAudit{}
+	for _, audit := range audits {
+		switch {
+		case audit.Grade != nil:
+			completed = append(completed, audit)
+		case audit.EndAt == nil || audit.EndAt.After(now):
+			pending = append(pending, audit)
+		}
+	}
+	returnJson(w, r, UserAudits{
+		Pending:   pending,
+		Completed: completed,
+	})
+}
+
+// receivedAuditsHandler lists the audits of the groups the user is a member of
+func receivedAuditsHandler(w http.ResponseWriter, r *http.Request) {
+	audits, err := GetReceivedAudits(platformConfig.CampusName, contextUserId(r), apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	returnJson(w, r, audits)
+}
+
+func auditRatioHandler(w http.ResponseWriter, r *http.Request) {
+	ratio, err := GetAuditRatio(contextUserId(r), apiClient(r))
+	if errors.Is(err, ErrUserNotFound) {
+		returnJsonError(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	returnJson(w, r, ratio)
+}
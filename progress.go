@@ -0,0 +1,286 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type XpTransaction struct {
+	Amount    int       `json:"amount"`
+	EventId   int       `json:"eventId"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UserXp is the total xp of a user with its split per event and, on demand, over time
+type UserXp struct {
+	Total  int       `json:"total"`
+	Events []EventXp `json:"events"`
+	// a pointer so that an empty series is still returned when an interval is requested
+	Series *[]XpPoint `json:"series,omitempty"`
+}
+
+// UserProgress are the exercises of a user split by result
+type UserProgress struct {
+	Passed []ProgressEntry  `json:"passed"`
+	Failed []ProgressEntry  `json:"failed"`
+	Series *[]ProgressPoint `json:"series,omitempty"`
+}
+
+type EventXp struct {
+	EventId int    `json:"eventId"`
+	Name    string `json:"name"`
+	Amount  int    `json:"amount"`
+}
+
+type XpPoint struct {
+	Date   string `json:"date"`
+	Amount int    `json:"amount"`
+	// The XP earned up to the end of the period
+	Total int `json:"total"`
+}
+
+type ProgressEntry struct {
+	ObjectId  int       `json:"objectId"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Path      string    `json:"path"`
+	Grade     float64   `json:"grade"`
+	EventId   int       `json:"eventId"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Passed reports whether the exercise is passed, which is the case for any grade of at least 1
+func (p ProgressEntry) Passed() bool {
+	return p.Grade >= 1
+}
+
+type ProgressPoint struct {
+	Date   string `json:"date"`
+	Passed int    `json:"passed"`
+	Failed int    `json:"failed"`
+}
+
+// courseIds returns the ids of the courses
+func courseIds(courses []Course) []int {
+	ids := make([]int, 0, len(courses))
+	for _, course := range courses {
+		ids = append(ids, course.Id)
+	}
+	return ids
+}
+
+func timestampOrZero(value interface{}) time.Time {
+	if t := parseTimestamp(value); t != nil {
+		return *t
+	}
+	return time.Time{}
+}
+
+// GetUserXp returns the xp transactions of the user on the given events, oldest first
+func GetUserXp(campusName string, userId int, eventIds []int, client *ApiInterface.Client) ([]XpTransaction, error) {
+	query, err := loadQueryFromFile("queries/get_user_xp.graphql")
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.Run(query, map[string]interface{}{"campusName": campusName, "userID": userId, "eventIds": eventIds})
+	if err != nil {
+		return nil, err
+	}
+	var transactions []XpTransaction
+	for _, v := range data["transaction"].([]interface{}) {
+		transaction := v.(map[string]interface{})
+		xp := XpTransaction{
+			Amount:    int(transaction["amount"].(float64)),
+			CreatedAt: timestampOrZero(transaction["createdAt"]),
+		}
+		eventId, _ := transaction["eventId"].(float64)
+		xp.EventId = int(eventId)
+		xp.Path, _ = transaction["path"].(string)
+		transactions = append(transactions, xp)
+	}
+	return transactions, nil
+}
+
+// GetUserProgress returns the graded progresses of the user on the given events, oldest first
+func GetUserProgress(campusName string, userId int, eventIds []int, client *ApiInterface.Client) ([]ProgressEntry, error) {
+	query, err := loadQueryFromFile("queries/get_user_progress.graphql")
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.Run(query, map[string]interface{}{"campusName": campusName, "userID": userId, "eventIds": eventIds})
+	if err != nil {
+		return nil, err
+	}
+	var entries []ProgressEntry
+	for _, v := range data["progress"].([]interface{}) {
+		progress := v.(map[string]interface{})
+		object := progress["object"].(map[string]interface{})
+		entry := ProgressEntry{
+			ObjectId:  int(object["id"].(float64)),
+			Name:      object["name"].(string),
+			Type:      object["type"].(string),
+			Grade:     progress["grade"].(float64),
+			CreatedAt: timestampOrZero(progress["createdAt"]),
+			UpdatedAt: timestampOrZero(progress["updatedAt"]),
+		}
+		eventId, _ := progress["eventId"].(float64)
+		entry.EventId = int(eventId)
+		entry.Path, _ = progress["path"].(string)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// periodStart returns the label of the day or of the week (starting on monday) the time belongs to
+func periodStart(t time.Time, interval string) string {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if interval == "week" {
+		day = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day.Format("2006-01-02")
+}
+
+// parseInterval reads the interval parameter, an empty interval means no time series is requested
+func parseInterval(r *http.Request) (string, error) {
+	interval := r.URL.Query().Get("interval")
+	switch interval {
+	case "", "day", "week":
+		return interval, nil
+	}
+	return "", errors.New("invalid interval parameter, expected day or week")
+}
+
+// xpSeries sums the transactions per period, the transactions must be sorted by date
+func xpSeries(transactions []XpTransaction, interval string) []XpPoint {
+	series := []XpPoint{}
+	total := 0
+	for _, transaction := range transactions {
+		date := periodStart(transaction.CreatedAt, interval)
+		total += transaction.Amount
+		if len(series) == 0 || series[len(series)-1].Date != date {
+			series = append(series, XpPoint{Date: date})
+		}
+		series[len(series)-1].Amount += transaction.Amount
+		series[len(series)-1].Total = total
+	}
+	return series
+}
+
+// progressSeries counts the passed and failed exercises per period of their last update
+func progressSeries(entries []ProgressEntry, interval string) []ProgressPoint {
+	points := make(map[string]*ProgressPoint)
+	for _, entry := range entries {
+		date := periodStart(entry.UpdatedAt, interval)
+		if points[date] == nil {
+			points[date] = &ProgressPoint{Date: date}
+		}
+		if entry.Passed() {
+			points[date].Passed++
+		} else {
+			points[date].Failed++
+		}
+	}
+	series := make([]ProgressPoint, 0, len(points))
+	for _, point := range points {
+		series = append(series, *point)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Date < series[j].Date
+	})
+	return series
+}
+
+// userXpHandler returns the total xp of the user and its split per course, with ?interval=day|week the
+// xp earned per period is added for charts
+func userXpHandler(w http.ResponseWriter, r *http.Request) {
+	interval, err := parseInterval(r)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	courses, err := GetUserCourses(platformConfig.CampusName, contextUserId(r), apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, upstreamErrorStatus(err))
+		return
+	}
+	var transactions []XpTransaction
+	if len(courses) > 0 {
+		transactions, err = GetUserXp(platformConfig.CampusName, contextUserId(r), courseIds(courses), apiClient(r))
+		if err != nil {
+			returnJsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	total := 0
+	perEvent := make(map[int]int)
+	for _, transaction := range transactions {
+		total += transaction.Amount
+		perEvent[transaction.EventId] += transaction.Amount
+	}
+	events := make([]EventXp, 0, len(courses))
+	for _, course := range courses {
+		events = append(events, EventXp{EventId: course.Id, Name: course.Name, Amount: perEvent[course.Id]})
+	}
+	var series *[]XpPoint
+	if interval != "" {
+		points := xpSeries(transactions, interval)
+		series = &points
+	}
+	// no Last-Modified: the newest transaction does not change when one is deleted or the user leaves a
+	// course, the ETag computed over the body does
+	returnJson(w, r, UserXp{
+		Total:  total,
+		Events: events,
+		Series: series,
+	})
+}
+
+// userProgressHandler returns the passed and failed exercises of the user, with ?interval=day|week the
+// number of exercises passed and failed per period is added for charts
+func userProgressHandler(w http.ResponseWriter, r *http.Request) {
+	interval, err := parseInterval(r)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	courses, err := GetUserCourses(platformConfig.CampusName, contextUserId(r), apiClient(r))
+	if err != nil {
+		returnJsonError(w, r, err, upstreamErrorStatus(err))
+		return
+	}
+	var entries []ProgressEntry
+	if len(courses) > 0 {
+		entries, err = GetUserProgress(platformConfig.CampusName, contextUserId(r), courseIds(courses), apiClient(r))
+		if err != nil {
+			returnJsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	passed, failed := []ProgressEntry{}, []ProgressEntry{}
+	for _, entry := range entries {
+		if entry.Passed() {
+			passed = append(passed, entry)
+		} else {
+			failed = append(failed, entry)
+		}
+	}
+	var series *[]ProgressPoint
+	if interval != "" {
+		points := progressSeries(entries, interval)
+		series = &points
+	}
+	// like userXpHandler, only the ETag tells whether the progress changed
+	returnJson(w, r, UserProgress{
+		Passed: passed,
+		Failed: failed,
+		Series: series,
+	})
+}
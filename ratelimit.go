@@ -0,0 +1,186 @@
+package main
+
+import (
+	"Ytrack-Manager/tools"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errRateLimited = errors.New("too many requests, retry later")
+
+// The buckets of the rate limiter, nil when rate limiting is disabled
+var rateLimits *rateLimitBuckets
+
+type rateLimitBuckets struct {
+	userRead, userWrite *rateLimiter
+	ipRead, ipWrite     *rateLimiter
+}
+
+// setupRateLimits creates the buckets described by the configuration
+func setupRateLimits(config tools.RateLimitConfig) {
+	if !config.Enabled {
+		rateLimits = nil
+		return
+	}
+	rateLimits = &rateLimitBuckets{
+		userRead:  newRateLimiter(config.User.Read),
+		userWrite: newRateLimiter(config.User.Write),
+		ipRead:    newRateLimiter(config.Ip.Read),
+		ipWrite:   newRateLimiter(config.Ip.Write),
+	}
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// rateLimiter keeps a token bucket per key, the buckets that are full again are dropped once a minute
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens added per second
+	burst   float64
+	buckets map[string]*tokenBucket
+	sweptAt time.Time
+}
+
+// rateDecision is the state of a bucket after a request took a token from it
+type rateDecision struct {
+	allowed   bool
+	limit     int
+	remaining int
+	// reset is the time until the bucket is full again, retryAfter the time until the next token when
+	// the request was refused
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// newRateLimiter returns nil when the requests are not limited
+func newRateLimiter(config tools.BucketConfig) *rateLimiter {
+	if config.PerMinute <= 0 {
+		return nil
+	}
+	burst := config.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:    float64(config.PerMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// refill adds the tokens earned since the last update of the bucket
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*l.rate)
+	bucket.updatedAt = now
+}
+
+func (l *rateLimiter) take(key string, now time.Time) rateDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.sweptAt) > time.Minute {
+		for k, bucket := range l.buckets {
+			if l.refill(bucket, now); bucket.tokens >= l.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.sweptAt = now
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updatedAt: now}
+		l.buckets[key] = bucket
+	}
+	l.refill(bucket, now)
+
+	decision := rateDecision{limit: int(l.burst)}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		decision.allowed = true
+	} else {
+		decision.retryAfter = seconds((1 - bucket.tokens) / l.rate)
+	}
+	decision.remaining = int(bucket.tokens)
+	decision.reset = seconds((l.burst - bucket.tokens) / l.rate)
+	return decision
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// ceilSeconds formats the duration as a whole number of seconds, rounded up so clients never retry too early
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// The key of the *rateDecision reported by rateLimit in the request context
+const rateDecisionKey contextKey = "rateDecision"
+
+// limiters returns the buckets used by the method, nil when rate limiting is disabled
+func (l *rateLimitBuckets) limiters(method string) (user *rateLimiter, ip *rateLimiter) {
+	if method == "GET" || method == "HEAD" {
+		return l.userRead, l.ipRead
+	}
+	return l.userWrite, l.ipWrite
+}
+
+// writeRateDecision sets the RateLimit-* headers, and answers 429 with Retry-After when the request was
+// refused. It returns whether the request may go on.
+func writeRateDecision(w http.ResponseWriter, r *http.Request, decision rateDecision) bool {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+	w.Header().Set("RateLimit-Reset", ceilSeconds(decision.reset))
+	if !decision.allowed {
+		w.Header().Set("Retry-After", ceilSeconds(decision.retryAfter))
+		returnJsonError(w, r, errRateLimited, http.StatusTooManyRequests)
+	}
+	return decision.allowed
+}
+
+// rateLimit takes a token from the bucket of the client ip, refused requests get a 429 with Retry-After.
+// The bucket of the user is only known once the token is verified, see limitUser.
+func rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limits := rateLimits
+		if limits == nil || r.Method == "OPTIONS" {
+			next(w, r)
+			return
+		}
+		_, ipLimiter := limits.limiters(r.Method)
+		if ipLimiter == nil {
+			next(w, r)
+			return
+		}
+		decision := ipLimiter.take(clientIp(r), time.Now())
+		if !writeRateDecision(w, r, decision) {
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), rateDecisionKey, &decision)))
+	}
+}
+
+// limitUser takes a token from the bucket of the verified user. The RateLimit-* headers describe the
+// bucket, ip or user, closest to being empty.
+func limitUser(w http.ResponseWriter, r *http.Request, userId int) bool {
+	limits := rateLimits
+	if limits == nil || r.Method == "OPTIONS" {
+		return true
+	}
+	userLimiter, _ := limits.limiters(r.Method)
+	if userLimiter == nil {
+		return true
+	}
+	decision := userLimiter.take(strconv.Itoa(userId), time.Now())
+	if ipDecision, ok := r.Context().Value(rateDecisionKey).(*rateDecision); ok && decision.allowed && ipDecision.remaining < decision.remaining {
+		return true
+	}
+	return writeRateDecision(w, r, decision)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"Ytrack-Manager/tools"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// one token a second, up to 3
+	limiter := newRateLimiter(tools.BucketConfig{PerMinute: 60, Burst: 3})
+	steps := []struct {
+		at         time.Duration
+		key        string
+		allowed    bool
+		remaining  int
+		reset      time.Duration
+		retryAfter time.Duration
+	}{
+		{0, "a", true, 2, time.Second, 0},
+		{0, "a", true, 1, 2 * time.Second, 0},
+		{0, "a", true, 0, 3 * time.Second, 0},
+		{0, "a", false, 0, 3 * time.Second, time.Second},
+		{500 * time.Millisecond, "a", false, 0, 2500 * time.Millisecond, 500 * time.Millisecond},
+		{time.Second, "a", true, 0, 3 * time.Second, 0},
+		// the other keys have their own bucket
+		{time.Second, "b", true, 2, time.Second, 0},
+		// the refill stops at the burst
+		{time.Minute, "a", true, 2, time.Second, 0},
+	}
+	for i, step := range steps {
+		d := limiter.take(step.key, start.Add(step.at))
+		if d.allowed != step.allowed || d.remaining != step.remaining || d.limit != 3 {
+			t.Errorf("step %d: got allowed %v remaining %d limit %d, expected %v %d 3", i, d.allowed, d.remaining, d.limit, step.allowed, step.remaining)
+		}
+		if (d.reset-step.reset).Abs() > time.Millisecond || (d.retryAfter-step.retryAfter).Abs() > time.Millisecond {
+			t.Errorf("step %d: got reset %v retry after %v, expected %v %v", i, d.reset, d.retryAfter, step.reset, step.retryAfter)
+		}
+	}
+}
+
+func TestRateLimiterSweepsFullBuckets(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// one token every 10 minutes
+	limiter := newRateLimiter(tools.BucketConfig{PerMinute: 1, Burst: 2})
+	limiter.rate = 1.0 / 600
+	limiter.take("idle", start)
+	limiter.take("busy", start)
+	limiter.take("busy", start)
+	// the idle bucket is full again 10 minutes later, the busy one is not
+	limiter.take("other", start.Add(10*time.Minute))
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Error("the full bucket was not swept")
+	}
+	if _, ok := limiter.buckets["busy"]; !ok {
+		t.Error("a bucket still refilling was swept")
+	}
+	// a swept key starts again from a full bucket
+	if d := limiter.take("idle", start.Add(10*time.Minute)); !d.allowed || d.remaining != 1 {
+		t.Errorf("got allowed %v remaining %d for a swept key", d.allowed, d.remaining)
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	if newRateLimiter(tools.BucketConfig{PerMinute: 0, Burst: 10}) != nil {
+		t.Error("a bucket without a rate must leave the requests unlimited")
+	}
+	if limiter := newRateLimiter(tools.BucketConfig{PerMinute: 10}); limiter.burst != 1 {
+		t.Errorf("got a burst of %v, expected at least 1", limiter.burst)
+	}
+}
+
+func TestCeilSeconds(t *testing.T) {
+	for d, expected := range map[time.Duration]string{0: "0", time.Millisecond: "1", time.Second: "1", 1500 * time.Millisecond: "2"} {
+		if got := ceilSeconds(d); got != expected {
+			t.Errorf("ceilSeconds(%v) = %s, expected %s", d, got, expected)
+		}
+	}
+}
+
+func TestRateLimitIgnoresSpoofedHeaders(t *testing.T) {
+	setupRateLimits(tools.RateLimitConfig{Enabled: true, Ip: tools.RateLimits{Write: tools.BucketConfig{PerMinute: 1, Burst: 1}}})
+	defer setupRateLimits(tools.RateLimitConfig{})
+	handler := rateLimit(func(w http.ResponseWriter, r *http.Request) {})
+	statuses := []int{}
+	for _, forwarded := range []string{"198.51.100.1", "198.51.100.2"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/v1/campus/courses/register", nil)
+		r.Header.Set("X-Forwarded-For", forwarded)
+		r.Header.Set("x-token", "not.verified.yet")
+		handler(w, r)
+		statuses = append(statuses, w.Code)
+	}
+	if statuses[0] != http.StatusOK || statuses[1] != http.StatusTooManyRequests {
+		t.Errorf("got %v, expected the second request to be limited", statuses)
+	}
+}
+
+func TestLimitUser(t *testing.T) {
+	setupRateLimits(tools.RateLimitConfig{Enabled: true, User: tools.RateLimits{Write: tools.BucketConfig{PerMinute: 1, Burst: 1}}})
+	defer setupRateLimits(tools.RateLimitConfig{})
+	r := httptest.NewRequest("POST", "/v1/campus/courses/register", nil)
+	if !limitUser(httptest.NewRecorder(), r, 7) {
+		t.Fatal("the first request of the user was refused")
+	}
+	if !limitUser(httptest.NewRecorder(), r, 8) {
+		t.Fatal("a user was limited by the requests of another one")
+	}
+	w := httptest.NewRecorder()
+	if limitUser(w, r, 7) {
+		t.Fatal("the second request of the user was allowed")
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("got %d with Retry-After %q and RateLimit-Remaining %q", w.Code, w.Header().Get("Retry-After"), w.Header().Get("RateLimit-Remaining"))
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"Ytrack-Manager/ApiInterface"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+const problemTypePrefix = "urn:ytrack-manager:problem:"
+
+// Envelope wraps every JSON response, list endpoints add their pagination next to the data
+type Envelope struct {
+	Data       interface{} `json:"data"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Message is the response of the operations that have nothing else to return
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Pagination describes the page of a list, NextCursor is only set by the endpoints supporting cursors
+type Pagination struct {
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	HasMore    bool   `json:"hasMore"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// Problem is an RFC 7807 error response, Code is stable and meant to be matched by clients
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Code      string `json:"code"`
+	RequestId string `json:"requestId"`
+	// Errors details the invalid fields of a request body
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// The codes of the errors clients may want to tell apart from the status alone
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrUserNotFound, "user_not_found"},
+	{ApiInterface.ErrCampusNotFound, "campus_not_found"},
+	{ErrObjectNotFound, "object_not_found"},
+	{ErrGroupNotFound, "group_not_found"},
+	{ErrInvalidFeedToken, "invalid_feed_token"},
+	{errInjectedFault, "injected_fault"},
+}
+
+// The code used for any other error, by status
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusNotAcceptable:         "not_acceptable",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "upstream_error",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// errorCode returns the machine readable code of the error
+func errorCode(err error, status int) string {
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			return known.code
+		}
+	}
+	var statusErr *ApiInterface.StatusError
+	if errors.As(err, &statusErr) {
+		return "upstream_error"
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return "validation_failed"
+	}
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return "error"
+}
+
+// returnJsonError writes the error as an application/problem+json document
+func returnJsonError(w http.ResponseWriter, r *http.Request, err error, status int) {
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	slog.Log(r.Context(), level, "request failed", "status", status, "error", err)
+	// errors must never be reused by a cache
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Del("ETag")
+	w.Header().Del("Last-Modified")
+	w.Header().Set("Content-Type", "application/problem+json")
+	id := requestId(r)
+	w.Header().Set("X-Request-ID", id)
+	code := errorCode(err, status)
+	problem := Problem{
+		Type:      problemTypePrefix + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    err.Error(),
+		Code:      code,
+		RequestId: id,
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		problem.Errors = validationErr.Fields
+	}
+	jsonData, _ := json.Marshal(problem)
+	w.WriteHeader(status)
+	if _, err = w.Write(jsonData); err != nil {
+		slog.WarnContext(r.Context(), "response write failed", "error", err)
+	}
+}
+
+// returnJson writes the data in the response envelope with a strong ETag computed over the body, and answers
+// 304 Not Modified when the client already has this version (or, without If-None-Match, when it is not older
+// than Last-Modified)
+func returnJson(w http.ResponseWriter, r *http.Request, data interface{}) {
+	writeEnvelope(w, r, http.StatusOK, Envelope{Data: data})
+}
+
+func returnJsonStatus(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	writeEnvelope(w, r, status, Envelope{Data: data})
+}
+
+// returnJsonPage writes a page of a list with its pagination
+func returnJsonPage(w http.ResponseWriter, r *http.Request, data interface{}, pagination Pagination) {
+	writeEnvelope(w, r, http.StatusOK, Envelope{Data: data, Pagination: &pagination})
+}
+
+func writeEnvelope(w http.ResponseWriter, r *http.Request, status int, envelope Envelope) {
+	jsonData, err := json.Marshal(envelope)
+	if err != nil {
+		returnJsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	etag := computeETag(jsonData)
+	w.Header().Set("ETag", etag)
+	if status == http.StatusOK && notModified(r, etag, w.Header().Get("Last-Modified")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(status)
+	if _, err = w.Write(jsonData); err != nil {
+		slog.WarnContext(r.Context(), "response write failed", "error", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"Ytrack-Manager/tools"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// router registers the routes on its mux and keeps their documentation, the OpenAPI document is generated
+// from it
+type router struct {
+	mux    *http.ServeMux
+	routes []route
+}
+
+// route is a registered pattern with the documentation of the methods it answers
+type route struct {
+	pattern    string
+	operations []operation
+	// hidden routes, such as the documentation itself, are left out of the OpenAPI document
+	hidden bool
+}
+
+func newRouter() *router {
+	return &router{mux: http.NewServeMux()}
+}
+
+// handle registers an unversioned route with the shared middlewares
+func (rt *router) handle(pattern string, handler http.HandlerFunc, operations ...operation) {
+	rt.mux.HandleFunc(pattern, withMiddlewares(pattern, pattern, handler))
+	rt.routes = append(rt.routes, route{pattern: pattern, operations: operations})
+}
+
+// handleHidden registers a route that is not part of the API, it needs no documentation
+func (rt *router) handleHidden(pattern string, handler http.HandlerFunc) {
+	rt.mux.HandleFunc(pattern, withMiddlewares(pattern, pattern, handler))
+	rt.routes = append(rt.routes, route{pattern: pattern, hidden: true})
+}
+
+// apiVersion registers the routes of one version of the API under its prefix. Versions live side by side,
+// a /v2 handler is added with rt.version("/v2", nil).handle and goes through the same middlewares as v1.
+type apiVersion struct {
+	router *router
+	prefix string
+	legacy *legacyAliases
+}
+
+// legacyAliases keeps serving the routes of a version at their unprefixed path until the sunset date,
+// with headers telling clients to move to the prefixed path. The aliases answer like the routes did before
+// they were versioned, see legacyResponse and legacyHandlers.
+type legacyAliases struct {
+	deprecatedAt time.Time
+	sunsetAt     time.Time
+}
+
+// newLegacyAliases parses the legacy routes settings, it returns nil when the aliases are disabled
+func newLegacyAliases(config tools.LegacyRoutesConfig) (*legacyAliases, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	deprecatedAt, err := time.Parse(time.DateOnly, config.DeprecatedAt)
+	if err != nil {
+		return nil, err
+	}
+	sunsetAt, err := time.Parse(time.DateOnly, config.SunsetAt)
+	if err != nil {
+		return nil, err
+	}
+	return &legacyAliases{deprecatedAt: deprecatedAt, sunsetAt: sunsetAt}, nil
+}
+
+func (rt *router) version(prefix string, legacy *legacyAliases) *apiVersion {
+	return &apiVersion{router: rt, prefix: prefix, legacy: legacy}
+}
+
+// handle registers the handler at the prefixed pattern, and at the pattern itself when the version keeps
+// legacy aliases. Only the prefixed route is documented.
+func (v *apiVersion) handle(pattern string, handler http.HandlerFunc, operations ...operation) {
+	v.router.mux.HandleFunc(v.prefix+pattern, withMiddlewares(v.prefix+pattern, pattern, handler))
+	v.router.routes = append(v.router.routes, route{pattern: v.prefix + pattern, operations: operations})
+	if v.legacy != nil {
+		if legacyHandler, ok := legacyHandlers[pattern]; ok {
+			handler = legacyHandler
+		}
+		// the adapter wraps the middlewares too, so that their errors are converted as well
+		v.router.mux.HandleFunc(pattern, legacyResponse(withMiddlewares(pattern, pattern, v.legacy.deprecated(v.prefix, handler))))
+	}
+}
+
+// deprecated adds the Deprecation (RFC 9745), Sunset (RFC 8594) and successor Link headers to the responses
+func (l *legacyAliases) deprecated(prefix string, next http.HandlerFunc) http.HandlerFunc {
+	deprecation := "@" + strconv.FormatInt(l.deprecatedAt.Unix(), 10)
+	sunset := l.sunsetAt.UTC().Format(http.TimeFormat)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", deprecation)
+		w.Header().Set("Sunset", sunset)
+		w.Header().Set("Link", "<"+prefix+r.URL.Path+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
+
+// withMiddlewares wraps the handler in the middlewares shared by every route of every version. The route
+// is the pattern registered on the mux, the pattern is the route without its version prefix.
+func withMiddlewares(route string, pattern string, handler http.HandlerFunc) http.HandlerFunc {
+	return traceRequest(route, accessLog(route, observeRequest(route, rateLimit(faultInjection(pattern, handler)))))
+}
@@ -6,13 +6,147 @@ import (
 )
 
 type Config struct {
-	CampusName string `json:"campusName"`
-	Domain     string `json:"domain"`
-	LocalStart bool   `json:"localStart"`
+	CampusName         string      `json:"campusName"`
+	Domain             string      `json:"domain"`
+	LocalStart         bool        `json:"localStart"`
+	AuditLogPath       string      `json:"auditLogPath"`
+	AdminRoles         []string    `json:"adminRoles"`
+	CalendarTokensPath string      `json:"calendarTokensPath"`
+	Cache              CacheConfig `json:"cache"`
+	// Debug enables the development only features such as fault injection, it must stay off in production
+	Debug bool `json:"debug"`
+	// FaultInjection maps a route pattern without its version prefix, or "*" for every route, to the faults
+	// injected in its requests
+	FaultInjection map[string]FaultConfig `json:"faultInjection"`
+	LegacyRoutes   LegacyRoutesConfig     `json:"legacyRoutes"`
+	// DisableDocs stops serving the Swagger UI and the OpenAPI document, for production deployments
+	DisableDocs bool `json:"disableDocs"`
+	// DisableMetrics stops serving the Prometheus metrics on /metrics
+	DisableMetrics bool            `json:"disableMetrics"`
+	Log            LogConfig       `json:"log"`
+	Tracing        TracingConfig   `json:"tracing"`
+	RateLimit      RateLimitConfig `json:"rateLimit"`
+	// TrustedProxies are the addresses or CIDR ranges of the reverse proxies in front of the service, the
+	// client address is only read from X-Forwarded-For when the request comes through one of them
+	TrustedProxies []string `json:"trustedProxies"`
+}
+
+// RateLimitConfig sets the token buckets of the requests. Every request takes a token from the bucket of its
+// client ip and, once its x-token is verified, from the bucket of its user. GET and HEAD requests use the read
+// buckets, the other methods the write buckets.
+type RateLimitConfig struct {
+	Enabled bool       `json:"enabled"`
+	User    RateLimits `json:"user"`
+	Ip      RateLimits `json:"ip"`
+}
+
+type RateLimits struct {
+	Read  BucketConfig `json:"read"`
+	Write BucketConfig `json:"write"`
+}
+
+// BucketConfig is a token bucket holding up to Burst requests and refilled with PerMinute requests a
+// minute, a PerMinute of 0 leaves the requests unlimited
+type BucketConfig struct {
+	PerMinute int `json:"perMinute"`
+	Burst     int `json:"burst"`
+}
+
+// TracingConfig selects where the OpenTelemetry spans are sent. Exporter is "otlp" to send them over
+// OTLP/HTTP to Endpoint (host:port, the collector default is localhost:4318), "stdout" to print them, or
+// empty to disable tracing. SampleRatio is the share of the traces started here that are recorded, the
+// traces started by a caller follow its decision.
+type TracingConfig struct {
+	Exporter    string  `json:"exporter"`
+	Endpoint    string  `json:"endpoint"`
+	Insecure    bool    `json:"insecure"`
+	ServiceName string  `json:"serviceName"`
+	SampleRatio float64 `json:"sampleRatio"`
+}
+
+// LogConfig selects how the service logs. Format is "json" or "text", when empty the logs are text for a
+// local start and JSON otherwise. Level is one of "debug", "info", "warn" or "error".
+type LogConfig struct {
+	Format string `json:"format"`
+	Level  string `json:"level"`
+}
+
+// LegacyRoutesConfig controls the unprefixed aliases of the /v1 routes, they keep the responses of the
+// former API. Dates are formatted as 2006-01-02.
+type LegacyRoutesConfig struct {
+	Enabled      bool   `json:"enabled"`
+	DeprecatedAt string `json:"deprecatedAt"`
+	SunsetAt     string `json:"sunsetAt"`
+}
+
+type CacheConfig struct {
+	Capacity     int `json:"capacity"`
+	TtlSeconds   int `json:"ttlSeconds"`
+	StaleSeconds int `json:"staleSeconds"`
+	// The directory where the caches are saved on shutdown, empty to keep them in memory only
+	PersistDir string `json:"persistDir"`
+}
+
+// FaultConfig describes the latency and errors added to the requests of a route when debugging
+type FaultConfig struct {
+	Latency LatencyConfig `json:"latency"`
+	// ErrorRate is the probability, between 0 and 1, that a request fails instead of reaching the handler
+	ErrorRate float64 `json:"errorRate"`
+	// StatusCodes are picked at random for the failed requests, 503 is used when empty
+	StatusCodes []int `json:"statusCodes"`
+}
+
+// LatencyConfig is the distribution of the delay added before a request is handled.
+// Distribution is one of "fixed" (MeanMs), "uniform" (MinMs to MaxMs), "normal" (MeanMs and StdDevMs)
+// or "exponential" (MeanMs), no delay is added when it is empty.
+type LatencyConfig struct {
+	Distribution string `json:"distribution"`
+	MinMs        int    `json:"minMs"`
+	MaxMs        int    `json:"maxMs"`
+	MeanMs       int    `json:"meanMs"`
+	StdDevMs     int    `json:"stdDevMs"`
+}
+
+// DefaultConfig returns the values used for any setting missing from the configuration file
+func DefaultConfig() Config {
+	return Config{
+		AuditLogPath:       "audit.jsonl",
+		AdminRoles:         []string{"admin", "campus_admin"},
+		CalendarTokensPath: "calendar-tokens.json",
+		Cache: CacheConfig{
+			Capacity:     128,
+			TtlSeconds:   300,
+			StaleSeconds: 3600,
+		},
+		LegacyRoutes: LegacyRoutesConfig{
+			Enabled:      true,
+			DeprecatedAt: "2026-10-19",
+			SunsetAt:     "2027-04-19",
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Tracing: TracingConfig{
+			ServiceName: "ytrack-manager",
+			SampleRatio: 1,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			User: RateLimits{
+				Read:  BucketConfig{PerMinute: 120, Burst: 60},
+				Write: BucketConfig{PerMinute: 20, Burst: 10},
+			},
+			// a whole campus can share the same address
+			Ip: RateLimits{
+				Read:  BucketConfig{PerMinute: 1200, Burst: 300},
+				Write: BucketConfig{PerMinute: 120, Burst: 60},
+			},
+		},
+	}
 }
 
 func LoadConfigFromFile(path string) (Config, error) {
-	var config Config
+	config := DefaultConfig()
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return Config{}, err
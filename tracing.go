@@ -0,0 +1,82 @@
+package main
+
+import (
+	"Ytrack-Manager/tools"
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+)
+
+var tracer = otel.Tracer("Ytrack-Manager")
+
+// setupTracing installs the W3C trace context propagator and, when an exporter is configured, the tracer
+// provider exporting the spans. The returned function flushes the spans left on shutdown.
+func setupTracing(ctx context.Context, config tools.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.Endpoint)}
+		if config.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, errors.New("invalid tracing exporter " + config.Exporter + ", expected otlp, stdout or nothing")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return nil, errors.New("the tracing sample ratio must be between 0 and 1")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(config.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// traceRequest runs the handler in a server span named after the route, continuing the trace of the
+// caller when the request carries a traceparent header
+func traceRequest(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(methodLabel(r.Method)),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+			))
+		defer span.End()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next(recorder, r.WithContext(ctx))
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	}
+}
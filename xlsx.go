@@ -0,0 +1,96 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const xlsxMimeType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// The static parts of a workbook containing a single worksheet
+var xlsxStaticParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// xlsxColumn converts a zero based column index to its spreadsheet name (0 -> A, 26 -> AA)
+func xlsxColumn(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func xlsxEscape(value string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+// writeXlsx writes the rows as a single sheet workbook, ints are stored as numbers and everything else as text
+func writeXlsx(w io.Writer, sheetName string, rows [][]interface{}) error {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxStaticParts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(file, part.content); err != nil {
+			return err
+		}
+	}
+
+	workbook, err := archive.Create("xl/workbook.xml")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(workbook, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`, xlsxEscape(sheetName))
+	if err != nil {
+		return err
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		var b strings.Builder
+		b.WriteString(`<row r="` + strconv.Itoa(i+1) + `">`)
+		for j, value := range row {
+			ref := xlsxColumn(j) + strconv.Itoa(i+1)
+			switch v := value.(type) {
+			case int:
+				b.WriteString(`<c r="` + ref + `"><v>` + strconv.Itoa(v) + `</v></c>`)
+			default:
+				b.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">` + xlsxEscape(fmt.Sprint(v)) + `</t></is></c>`)
+			}
+		}
+		b.WriteString(`</row>`)
+		if _, err = io.WriteString(sheet, b.String()); err != nil {
+			return err
+		}
+	}
+	if _, err = io.WriteString(sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return archive.Close()
+}